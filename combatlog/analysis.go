@@ -1,39 +1,225 @@
 package combatlog
 
-type WindowFunc func(lastStart, start, lastEnd, end int)
+import (
+	"time"
+)
 
-func (cl CombatLog) RollingWindow(seconds, stepBy int, fun WindowFunc) {
+// WindowKind selects how CombatLog.Windows divides a log.
+type WindowKind int
+
+const (
+	// Sliding windows of Size nanoseconds start every Step nanoseconds, so
+	// they overlap if Step is less than Size.
+	Sliding WindowKind = iota
+
+	// Tumbling windows of Size nanoseconds follow each other without
+	// overlapping.
+	Tumbling
+
+	// Session windows contain runs of events with no gap longer than Gap
+	// nanoseconds between them.
+	Session
+)
+
+// An Aggregator incrementally computes a value over the events in a window.
+// Add is called for each event as it enters the window and Remove as it
+// leaves, so each event is only seen twice however much windows overlap.
+// A Meter with a fixed range is an Aggregator.
+type Aggregator interface {
+	Add(e Event)
+	Remove(e Event)
+}
+
+// WindowOptions describes the windows passed to the function given to
+// CombatLog.Windows.  All times are in nanoseconds.
+type WindowOptions struct {
+	Kind WindowKind
+	Size int64 // length of Sliding and Tumbling windows
+	Step int64 // time between Sliding windows; defaults to Size
+	Gap  int64 // longest gap within a Session window
+
+	// Align, if set, is the start of the first Sliding or Tumbling window,
+	// such as the start of an encounter.  Events before it are not in any
+	// window.  By default windows start at the first event.
+	Align *time.Time
+
+	// Aggregator, if set, is kept up to date with the events in the window.
+	Aggregator Aggregator
+}
+
+// A Window is a period of the log and the events in it.
+type Window struct {
+	Start, End time.Time // the window is [Start, End)
+	Events     CombatLog
+}
+
+// Duration returns the length of the window in nanoseconds.
+func (w Window) Duration() int64 {
+	return w.End.Nanoseconds() - w.Start.Nanoseconds()
+}
+
+// Windows calls fun for each window of the log described by opts, in order.
+// Sliding and Tumbling windows are reported even if they are empty.  The
+// log must be in time order.  It runs in time proportional to the number of
+// events and windows.
+func (cl CombatLog) Windows(opts WindowOptions, fun func(w Window)) {
+	if opts.Kind != Session && opts.Size <= 0 {
+		panic("combatlog: Windows: window size must be positive")
+	}
+	cl.windows(opts, func(start, end time.Time, lo, hi int) {
+		fun(Window{
+			Start:  start,
+			End:    end,
+			Events: cl[lo:hi],
+		})
+	})
+}
+
+// windows is Windows, but passes fun the bounds of each window and the
+// indices of the events in it, cl[lo:hi].  Sliding windows may be empty.
+func (cl CombatLog) windows(opts WindowOptions, fun func(start, end time.Time, lo, hi int)) {
 	if len(cl) == 0 {
 		return
 	}
 
-	var lastStart, start, lastEnd, end int
+	if opts.Kind == Session {
+		cl.sessions(opts, fun)
+		return
+	}
 
-	threshold := int64(seconds) * 1e9
-	startTime := cl[0].Time.Nanoseconds()
+	size, step := opts.Size, opts.Step
+	if opts.Kind == Tumbling || step <= 0 {
+		step = size
+	}
+	if step <= 0 {
+		panic("combatlog: Windows: window step must be positive")
+	}
 
-	for start < len(cl) {
-		// Find the start of the window
-		for _, e := range cl[start:] {
-			time := e.Time.Nanoseconds()
-			if time >= startTime {
-				break
+	zone := cl[0].Time
+	first, last := cl[0].Time.Nanoseconds(), cl[len(cl)-1].Time.Nanoseconds()
+	start := first
+	if opts.Align != nil {
+		start = opts.Align.Nanoseconds()
+
+		// Skip windows which end before the log starts
+		if start+size <= first {
+			start += (first - start - size) / step * step
+			for start+size <= first {
+				start += step
 			}
-			start++
 		}
-		// Find the end of the window
-		if end < start {
-			end = start
+	}
+
+	var agg window
+	agg.cl, agg.agg = cl, opts.Aggregator
+	for ; start <= last; start += step {
+		end := start + size
+		lo, hi := agg.lo, agg.hi
+		for lo < len(cl) && cl[lo].Time.Nanoseconds() < start {
+			lo++
 		}
-		for _, e := range cl[end:] {
-			time := e.Time.Nanoseconds()
-			if time - startTime >= threshold {
+		if hi < lo {
+			hi = lo
+		}
+		for hi < len(cl) && cl[hi].Time.Nanoseconds() < end {
+			hi++
+		}
+		agg.move(lo, hi)
+		fun(timeAt(start, zone), timeAt(end, zone), lo, hi)
+	}
+	agg.move(len(cl), len(cl))
+}
+
+// sessions calls fun for each session window of cl.
+func (cl CombatLog) sessions(opts WindowOptions, fun func(start, end time.Time, lo, hi int)) {
+	var agg window
+	agg.cl, agg.agg = cl, opts.Aggregator
+	for lo := 0; lo < len(cl); {
+		hi := lo + 1
+		prev := cl[lo].Time.Nanoseconds()
+		for hi < len(cl) {
+			ns := cl[hi].Time.Nanoseconds()
+			if ns-prev > opts.Gap {
 				break
 			}
-			end++
+			prev = ns
+			hi++
 		}
+		agg.move(lo, hi)
+
+		// The window ends just after its last event
+		end := cl[hi-1].Time
+		fun(cl[lo].Time, timeAt(end.Nanoseconds()+1, end), lo, hi)
+		lo = hi
+	}
+	agg.move(len(cl), len(cl))
+}
+
+// A window tracks the events of cl in the current window, cl[lo:hi], and
+// keeps an Aggregator up to date with them.
+type window struct {
+	cl     CombatLog
+	agg    Aggregator
+	lo, hi int
+}
+
+// move moves the window to cl[lo:hi].  Both ends may only move forward.
+func (w *window) move(lo, hi int) {
+	if w.agg != nil {
+		for i := w.lo; i < w.hi && i < lo; i++ {
+			w.agg.Remove(w.cl[i])
+		}
+		i := w.hi
+		if i < lo {
+			i = lo
+		}
+		for ; i < hi; i++ {
+			w.agg.Add(w.cl[i])
+		}
+	}
+	w.lo, w.hi = lo, hi
+}
+
+// timeAt returns the time ns nanoseconds after the epoch in the zone of t.
+func timeAt(ns int64, t time.Time) time.Time {
+	at := time.NanosecondsToUTC(ns + int64(t.ZoneOffset)*1e9)
+	at.ZoneOffset, at.Zone = t.ZoneOffset, t.Zone
+	return *at
+}
+
+// Windows calls fun for each window of the encounter described by opts.
+// Unless opts.Align is set, Sliding and Tumbling windows are aligned to the
+// start of the encounter.
+func (e Encounter) Windows(opts WindowOptions, fun func(w Window)) {
+	if opts.Align == nil {
+		opts.Align = &e.Start
+	}
+	e.Events.Windows(opts, fun)
+}
+
+// A WindowFunc is called by RollingWindow with the index ranges of the
+// previous and current windows.
+type WindowFunc func(lastStart, start, lastEnd, end int)
+
+// RollingWindow calls fun for sliding windows of the given number of seconds
+// starting every stepBy seconds.  New code should use Windows.
+func (cl CombatLog) RollingWindow(seconds, stepBy int, fun WindowFunc) {
+	if len(cl) == 0 {
+		return
+	}
+
+	// Windows of zero seconds are allowed, and are always empty
+	var lastStart, lastEnd int
+	opts := WindowOptions{
+		Kind: Sliding,
+		Size: int64(seconds) * 1e9,
+		Step: int64(stepBy) * 1e9,
+	}
+	cl.windows(opts, func(_, _ time.Time, start, end int) {
 		fun(lastStart, start, lastEnd, end)
 		lastStart, lastEnd = start, end
-		startTime += int64(stepBy) * 1e9
-	}
+	})
+
+	// RollingWindow has always ended with a window past the last event
+	fun(lastStart, len(cl), lastEnd, len(cl))
 }
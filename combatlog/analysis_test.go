@@ -1,6 +1,7 @@
 package combatlog
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -94,3 +95,78 @@ func TestWindow(t *testing.T) {
 			test.LastStart, test.Start, test.LastEnd, test.End)
 	}
 }
+
+func TestWindowEmpty(t *testing.T) {
+	n := 0
+	testCombatLog.RollingWindow(0, 3, func(ls, s, le, e int) {
+		if s != e {
+			t.Errorf("%d. got window(%d, %d, %d, %d), want an empty window", n, ls, s, le, e)
+		}
+		n++
+	})
+	if n == 0 {
+		t.Errorf("got no windows")
+	}
+}
+
+// countAggregator counts the events in the window.
+type countAggregator struct {
+	count, added int
+}
+
+func (c *countAggregator) Add(e Event)    { c.count++; c.added++ }
+func (c *countAggregator) Remove(e Event) { c.count-- }
+
+func TestWindows(t *testing.T) {
+	align := time.Time{Year: 2011, Minute: 1, Second: 9}
+	tests := []struct {
+		Desc   string
+		Opts   WindowOptions
+		Counts []int
+	}{
+		{
+			Desc:   "tumbling",
+			Opts:   WindowOptions{Kind: Tumbling, Size: 10e9},
+			Counts: []int{7, 2, 0, 0, 5, 3},
+		},
+		{
+			Desc:   "sliding",
+			Opts:   WindowOptions{Kind: Sliding, Size: 20e9, Step: 10e9},
+			Counts: []int{9, 2, 0, 5, 8, 3},
+		},
+		{
+			Desc:   "aligned",
+			Opts:   WindowOptions{Kind: Tumbling, Size: 10e9, Align: &align},
+			Counts: []int{7, 2, 0, 0, 4, 4},
+		},
+		{
+			Desc:   "session",
+			Opts:   WindowOptions{Kind: Session, Gap: 3e9},
+			Counts: []int{8, 1, 8},
+		},
+	}
+
+	for _, test := range tests {
+		agg := new(countAggregator)
+		test.Opts.Aggregator = agg
+		var counts []int
+		testCombatLog.Windows(test.Opts, func(w Window) {
+			if agg.count != len(w.Events) {
+				t.Errorf("%s: window %d: aggregator has %d events, window has %d",
+					test.Desc, len(counts), agg.count, len(w.Events))
+			}
+			for _, e := range w.Events {
+				if ns := e.Time.Nanoseconds(); ns < w.Start.Nanoseconds() || ns >= w.End.Nanoseconds() {
+					t.Errorf("%s: window %d: event at %d outside window", test.Desc, len(counts), e.Time.Second)
+				}
+			}
+			counts = append(counts, len(w.Events))
+		})
+		if !reflect.DeepEqual(counts, test.Counts) {
+			t.Errorf("%s: counts = %v, want %v", test.Desc, counts, test.Counts)
+		}
+		if agg.count != 0 {
+			t.Errorf("%s: %d events left in aggregator", test.Desc, agg.count)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package combatlog
+
+import (
+	"sort"
+	"time"
+)
+
+// An AuraKey identifies a single aura: one caster's application of a spell
+// to a target.
+type AuraKey struct {
+	Target  GUID
+	Caster  GUID
+	SpellID uint64
+}
+
+// AuraStack records a change in the stack count of an aura.
+type AuraStack struct {
+	Time   time.Time
+	Stacks int64
+}
+
+// An AuraInterval is one continuous period during which an aura was up.
+type AuraInterval struct {
+	Key    AuraKey
+	Target Unit
+	Caster Unit
+	Spell  Spell
+	Type   AuraType
+
+	Start, End time.Time
+	Stacks     []AuraStack
+
+	// Preexisting is set if the aura was already up when tracking began,
+	// in which case Start is the time of the first event tracked.
+	Preexisting bool
+
+	// Open is set if the aura was never removed, in which case End is the
+	// time of the last event tracked.
+	Open bool
+}
+
+// Duration returns the length of the interval in nanoseconds.
+func (a *AuraInterval) Duration() int64 {
+	return a.End.Nanoseconds() - a.Start.Nanoseconds()
+}
+
+// An AuraTracker pairs up the SPELL_AURA_* events into AuraIntervals.
+// Events are added one at a time with Add, so it can be used while streaming
+// a log; CombatLog.Auras builds one from a finished log.
+type AuraTracker struct {
+	intervals []*AuraInterval
+	active    map[AuraKey]*AuraInterval
+
+	// The times of the first and last events added
+	first, last time.Time
+	started     bool
+}
+
+// NewAuraTracker returns an empty AuraTracker.
+func NewAuraTracker() *AuraTracker {
+	return &AuraTracker{
+		active: map[AuraKey]*AuraInterval{},
+	}
+}
+
+// Add updates the tracker with e.
+func (t *AuraTracker) Add(e Event) {
+	if !t.started {
+		t.first, t.started = e.Time, true
+	}
+	t.last = e.Time
+
+	switch data := e.Data.(type) {
+	case SpellAuraApplied:
+		if a := t.lookup(data.Common, data.Spell); a != nil {
+			t.close(a, e.Time)
+		}
+		a := t.open(data.Common, data.Spell, data.Aura, e.Time, false)
+		a.Stacks = append(a.Stacks, AuraStack{e.Time, 1})
+	case SpellAuraRefresh:
+		t.current(data.Common, data.Spell, data.Aura)
+	case SpellAuraAppliedDose:
+		a := t.current(data.Common, data.Spell, data.Aura)
+		a.Stacks = append(a.Stacks, AuraStack{e.Time, data.Amount})
+	case SpellAuraRemovedDose:
+		a := t.current(data.Common, data.Spell, data.Aura)
+		a.Stacks = append(a.Stacks, AuraStack{e.Time, data.Amount})
+	case SpellAuraRemoved:
+		t.close(t.current(data.Common, data.Spell, data.Aura), e.Time)
+	}
+}
+
+func auraKey(c Common, s Spell) AuraKey {
+	return AuraKey{
+		Target:  c.Dest.ID,
+		Caster:  c.Source.ID,
+		SpellID: s.ID,
+	}
+}
+
+// lookup returns the active interval for the aura, or nil.
+func (t *AuraTracker) lookup(c Common, s Spell) *AuraInterval {
+	return t.active[auraKey(c, s)]
+}
+
+// current returns the active interval for the aura.  If there is none, the
+// aura must have been up since before tracking began.
+func (t *AuraTracker) current(c Common, s Spell, aura Aura) *AuraInterval {
+	if a := t.lookup(c, s); a != nil {
+		return a
+	}
+	return t.open(c, s, aura, t.first, true)
+}
+
+func (t *AuraTracker) open(c Common, s Spell, aura Aura, start time.Time, pre bool) *AuraInterval {
+	a := &AuraInterval{
+		Key:         auraKey(c, s),
+		Target:      c.Dest,
+		Caster:      c.Source,
+		Spell:       s,
+		Type:        aura.Type,
+		Start:       start,
+		End:         start,
+		Preexisting: pre,
+		Open:        true,
+	}
+	t.active[a.Key] = a
+	t.intervals = append(t.intervals, a)
+	return a
+}
+
+func (t *AuraTracker) close(a *AuraInterval, end time.Time) {
+	a.End = end
+	a.Open = false
+	t.active[a.Key] = nil, false
+}
+
+// Intervals returns every interval seen so far, in the order in which they
+// were first seen.  Intervals which are still open end at the time of the
+// last event added.
+func (t *AuraTracker) Intervals() []*AuraInterval {
+	for _, a := range t.intervals {
+		if a.Open {
+			a.End = t.last
+		}
+	}
+	return t.intervals
+}
+
+// Find returns the intervals of the given spell on any target.
+func (t *AuraTracker) Find(spellID uint64) (found []*AuraInterval) {
+	for _, a := range t.Intervals() {
+		if a.Key.SpellID == spellID {
+			found = append(found, a)
+		}
+	}
+	return found
+}
+
+// Uptime returns the fraction (0 to 1) of the time between start and end
+// during which the target had the given aura from any caster.
+func (t *AuraTracker) Uptime(target GUID, spellID uint64, start, end time.Time) float64 {
+	from, to := start.Nanoseconds(), end.Nanoseconds()
+	if to <= from {
+		return 0
+	}
+
+	var spans spanList
+	for _, a := range t.Intervals() {
+		if a.Key.Target != target || a.Key.SpellID != spellID {
+			continue
+		}
+		s, e := a.Start.Nanoseconds(), a.End.Nanoseconds()
+		if s < from {
+			s = from
+		}
+		if e > to {
+			e = to
+		}
+		if s < e {
+			spans = append(spans, span{s, e})
+		}
+	}
+	return float64(spans.union()) / float64(to-from)
+}
+
+// Uptime returns the fraction of the encounter during which the target had
+// the given aura, according to t.  The tracker should have seen the events
+// before the encounter so that auras applied before the pull are counted.
+func (e Encounter) Uptime(t *AuraTracker, target GUID, spellID uint64) float64 {
+	return t.Uptime(target, spellID, e.Start, e.End)
+}
+
+// Auras returns an AuraTracker which has seen every event in the log.
+func (cl CombatLog) Auras() *AuraTracker {
+	t := NewAuraTracker()
+	for _, e := range cl {
+		t.Add(e)
+	}
+	return t
+}
+
+type span struct{ start, end int64 }
+
+type spanList []span
+
+func (l spanList) Len() int           { return len(l) }
+func (l spanList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l spanList) Less(i, j int) bool { return l[i].start < l[j].start }
+
+// union returns the total length covered by the spans.
+func (l spanList) union() (total int64) {
+	sort.Sort(l)
+	var curStart, curEnd int64
+	for i, s := range l {
+		if i == 0 || s.start > curEnd {
+			total += curEnd - curStart
+			curStart, curEnd = s.start, s.end
+		} else if s.end > curEnd {
+			curEnd = s.end
+		}
+	}
+	return total + curEnd - curStart
+}
@@ -0,0 +1,52 @@
+package combatlog
+
+import (
+	"testing"
+)
+
+func auraEvent(sec int, name string, data interface{}) Event {
+	return Event{Time: at(0, sec), Name: name, Data: data}
+}
+
+func TestAuraUptime(t *testing.T) {
+	const sunder = 7386
+	c := Common{Source: testRaider, Dest: testBoss}
+	s := Spell{ID: sunder, Name: "Sunder Armor"}
+	debuff := Aura{Type: AuraDebuff}
+
+	cl := CombatLog{
+		// Already up when the log starts
+		hit(at(0, 0), testRaider, testBoss, 1),
+		auraEvent(10, "SPELL_AURA_REMOVED", SpellAuraRemoved{c, s, debuff}),
+		auraEvent(20, "SPELL_AURA_APPLIED", SpellAuraApplied{c, s, debuff}),
+		auraEvent(25, "SPELL_AURA_APPLIED_DOSE", SpellAuraAppliedDose{c, s, debuff, 2}),
+		auraEvent(30, "SPELL_AURA_REMOVED", SpellAuraRemoved{c, s, debuff}),
+		// Never removed
+		auraEvent(35, "SPELL_AURA_APPLIED", SpellAuraApplied{c, s, debuff}),
+		hit(at(0, 40), testRaider, testBoss, 1),
+	}
+
+	auras := cl.Auras()
+	ivals := auras.Find(sunder)
+	if got, want := len(ivals), 3; got != want {
+		t.Fatalf("got %d intervals, want %d", got, want)
+	}
+	if !ivals[0].Preexisting || ivals[0].Duration() != 10e9 {
+		t.Errorf("first interval: preexisting=%v duration=%d, want true, 10s", ivals[0].Preexisting, ivals[0].Duration())
+	}
+	if got, want := len(ivals[1].Stacks), 2; got != want {
+		t.Errorf("second interval has %d stack changes, want %d", got, want)
+	} else if got, want := ivals[1].Stacks[1].Stacks, int64(2); got != want {
+		t.Errorf("second interval ends with %d stacks, want %d", got, want)
+	}
+	if !ivals[2].Open || ivals[2].Duration() != 5e9 {
+		t.Errorf("last interval: open=%v duration=%d, want true, 5s", ivals[2].Open, ivals[2].Duration())
+	}
+	if got, want := len(auras.active), 1; got != want {
+		t.Errorf("%d active auras, want %d", got, want)
+	}
+
+	if got, want := auras.Uptime(testBoss.ID, sunder, at(0, 0), at(0, 40)), 0.625; got != want {
+		t.Errorf("uptime = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package combatlog
+
+import (
+	"compress/gzip"
+	"gob"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	// CacheSuffix is appended to the name of a log to get the name of its
+	// cache.
+	CacheSuffix = ".cache"
+
+	// CacheVersion is incremented when the encoding of events changes, so
+	// that old caches are not used.
+	CacheVersion = 4
+
+	// cacheSumBytes is how much of each end of the log is checksummed to
+	// tell whether it has been rewritten without changing its size or
+	// modification time.
+	cacheSumBytes = 64 * 1024
+)
+
+// ErrStaleCache is returned by OpenCache if the cache does not match its log.
+var ErrStaleCache = os.NewError("combatlog: cache is out of date")
+
+func init() {
+	gob.Register(LogVersion{})
+	gob.Register(RawEvent{})
+}
+
+// A cacheKey identifies the log a cache was written from.
+type cacheKey struct {
+	Version int
+	Size    int64
+	Mtime   int64 // nanoseconds
+	Sum     uint32
+}
+
+func (k cacheKey) matches(o cacheKey) bool {
+	return k.Version == o.Version && k.Size == o.Size && k.Mtime == o.Mtime && k.Sum == o.Sum
+}
+
+// logKey returns the cacheKey for the log in filename.
+func logKey(filename string) (key cacheKey, err os.Error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return key, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return key, err
+	}
+
+	sum := crc32.NewIEEE()
+	head := make([]byte, cacheSumBytes)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != os.EOF {
+		return key, err
+	}
+	sum.Write(head[:n])
+	if tail := fi.Size - cacheSumBytes; tail > cacheSumBytes {
+		n, err = file.ReadAt(head, tail)
+		if err != nil && err != os.EOF {
+			return key, err
+		}
+		sum.Write(head[:n])
+	}
+
+	return cacheKey{
+		Version: CacheVersion,
+		Size:    fi.Size,
+		Mtime:   fi.Mtime_ns,
+		Sum:     sum.Sum32(),
+	}, nil
+}
+
+// LoadFile is like ReadFile, but uses the cache for filename if it is up to
+// date.  Otherwise it reads the log and writes a new cache for next time;
+// failing to write the cache is not an error.
+func LoadFile(filename string) (CombatLog, os.Error) {
+	if cr, err := OpenCache(filename); err == nil {
+		defer cr.Close()
+		var events CombatLog
+		for cr.Next() {
+			events = append(events, cr.Event())
+		}
+		if err := cr.Err(); err == nil {
+			return events, nil
+		}
+		// Fall back to the log if the cache is corrupt
+	}
+
+	// The key is taken first, so that if the log is appended to while it
+	// is read the cache is stale rather than missing the new events.
+	key, err := logKey(filename)
+	if err != nil {
+		return nil, err
+	}
+	cl, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	writeCache(filename, key, cl)
+	return cl, nil
+}
+
+// WriteCache writes a cache of cl, which must be the events in filename, to
+// filename+CacheSuffix.  The cache is written to a temporary file first so
+// that readers never see part of one.
+func WriteCache(filename string, cl CombatLog) os.Error {
+	key, err := logKey(filename)
+	if err != nil {
+		return err
+	}
+	return writeCache(filename, key, cl)
+}
+
+// writeCache writes a cache of cl, which was read from filename when it
+// had the given key.
+func writeCache(filename string, key cacheKey, cl CombatLog) (err os.Error) {
+	tmp := filename + CacheSuffix + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	z, err := gzip.NewWriterLevel(file, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(z)
+	if err := enc.Encode(key); err != nil {
+		return err
+	}
+	for i := range cl {
+		if err := enc.Encode(&cl[i]); err != nil {
+			return err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename+CacheSuffix)
+}
+
+// A CacheReader decodes the events in a cache one at a time.  It is used in
+// the same way as a Reader.
+type CacheReader struct {
+	closer io.Closer
+	dec    *gob.Decoder
+	event  Event
+	err    os.Error
+}
+
+// OpenCache opens the cache for the log in filename.  It returns ErrStaleCache
+// if there is a cache but the log has changed since it was written.  The
+// caller must call Close when done.
+func OpenCache(filename string) (*CacheReader, os.Error) {
+	file, err := os.Open(filename + CacheSuffix)
+	if err != nil {
+		return nil, err
+	}
+	z, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r := &CacheReader{
+		closer: multiCloser{z, file},
+		dec:    gob.NewDecoder(z),
+	}
+
+	var key cacheKey
+	want, err := logKey(filename)
+	if err == nil {
+		err = r.dec.Decode(&key)
+	}
+	if err == nil && !key.matches(want) {
+		err = ErrStaleCache
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Next advances the CacheReader to the next event.  It returns false at the
+// end of the cache or if an error occurs.
+func (r *CacheReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	// Zero fields are not encoded, so the event must start empty
+	r.event = Event{}
+	if err := r.dec.Decode(&r.event); err != nil {
+		if err != os.EOF {
+			r.err = err
+		}
+		return false
+	}
+	return true
+}
+
+// Event returns the most recent event decoded by Next.
+func (r *CacheReader) Event() Event {
+	return r.event
+}
+
+// Err returns the first error encountered by the CacheReader, or nil if it
+// stopped because it reached the end of the cache.
+func (r *CacheReader) Err() os.Error {
+	return r.err
+}
+
+// Close closes the cache.
+func (r *CacheReader) Close() os.Error {
+	return r.closer.Close()
+}
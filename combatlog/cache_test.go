@@ -0,0 +1,81 @@
+package combatlog
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	var lines string
+	for _, test := range decodeTests[:2] {
+		lines += test.Lines
+	}
+	name := tempLog(t, func(w io.Writer) os.Error {
+		_, err := io.WriteString(w, lines)
+		return err
+	})
+	defer os.Remove(name)
+	defer os.Remove(name + CacheSuffix)
+
+	if _, err := OpenCache(name); err == nil {
+		t.Fatalf("OpenCache before LoadFile succeeded")
+	}
+
+	want, err := LoadFile(name)
+	if err != nil {
+		t.Fatalf("LoadFile: %s", err)
+	}
+
+	cr, err := OpenCache(name)
+	if err != nil {
+		t.Fatalf("OpenCache: %s", err)
+	}
+	var got CombatLog
+	for cr.Next() {
+		got = append(got, cr.Event())
+	}
+	if err := cr.Err(); err != nil {
+		t.Errorf("cache: %s", err)
+	}
+	cr.Close()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cached events:\n got: %#v\nwant: %#v", got, want)
+	}
+
+	// Changing the log invalidates the cache
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("append: %s", err)
+	}
+	io.WriteString(file, decodeTests[0].Lines[1:])
+	file.Close()
+	if _, err := OpenCache(name); err != ErrStaleCache {
+		t.Errorf("OpenCache after append = %v, want %v", err, ErrStaleCache)
+	}
+	cl, err := LoadFile(name)
+	if err != nil {
+		t.Fatalf("LoadFile after append: %s", err)
+	}
+	if got, want := len(cl), len(want)+len(decodeTests[0].Events); got != want {
+		t.Errorf("LoadFile after append: got %d events, want %d", got, want)
+	}
+	// A log appended to while it was being read is stale
+	key, err := logKey(name)
+	if err != nil {
+		t.Fatalf("logKey: %s", err)
+	}
+	file, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("append: %s", err)
+	}
+	io.WriteString(file, decodeTests[1].Lines[1:])
+	file.Close()
+	if err := writeCache(name, key, cl); err != nil {
+		t.Fatalf("writeCache: %s", err)
+	}
+	if _, err := OpenCache(name); err != ErrStaleCache {
+		t.Errorf("OpenCache after append during read = %v, want %v", err, ErrStaleCache)
+	}
+}
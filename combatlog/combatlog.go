@@ -1,10 +1,16 @@
 package combatlog
 
 type Unit struct {
-	ID    uint64
-	Name  string
-	Flags UnitFlags
-	Flag2 int32
+	ID    GUID
+	Name  string    `combatlog:"quoted"`
+	Flags UnitFlags `combatlog:"hex"`
+	Flag2 RaidFlags `combatlog:"hex"`
+}
+
+// RaidMarker returns the raid target marker on the unit, or 0 if it is not
+// marked.
+func (u Unit) RaidMarker() RaidFlags {
+	return u.Flag2 & RaidTargetMask
 }
 
 type Common struct {
@@ -22,25 +28,73 @@ func (c Common) GetDest() Unit {
 	return c.Dest
 }
 
+// Advanced holds the extra unit information written between the prefix and
+// suffix of some events when advanced combat logging is enabled.  It
+// describes the unit performing the action (InfoGUID), which is usually the
+// source of the event.
+type Advanced struct {
+	InfoGUID    GUID
+	OwnerGUID   GUID
+	CurrentHP   int64
+	MaxHP       int64
+	AttackPower int64
+	SpellPower  int64
+	Armor       int64
+	Absorb      int64
+	// These are pipe-separated for units with more than one power type.
+	PowerType    string
+	CurrentPower string
+	MaxPower     string
+	PowerCost    string
+	PositionX    float64
+	PositionY    float64
+	UIMapID      int64
+	Facing       float64
+	Level        int64 // item level for players, unit level otherwise
+}
+func (a Advanced) GetAdvanced() Advanced {
+	return a
+}
+
+// These interfaces are satisfied by every event which embeds the structure
+// providing the method.
+type (
+	participants interface {
+		GetSource() Unit
+		GetDest() Unit
+	}
+	spelled interface {
+		GetSpell() Spell
+	}
+	damaged interface {
+		GetDamage() Damage
+	}
+	healed interface {
+		GetHeal() Heal
+	}
+)
+
 type Spell struct {
 	ID     uint64
-	Name   string
-	School SpellSchool
+	Name   string      `combatlog:"quoted"`
+	School SpellSchool `combatlog:"hex"`
 }
 func (s Spell) GetSpell() Spell {
 	return s
 }
 
 type Damage struct {
-	Amount   int64
-	Overkill int32
-	School   int32
-	Resisted int64
-	Blocked  int64
-	Absorbed int64
-	Critical bool
-	Glancing bool
-	Crushing bool
+	Amount      int64
+	Unmitigated int64 `combatlog:"modern"`
+	Overkill    int32
+	School      SpellSchool
+	Resisted    int64
+	Blocked     int64
+	Absorbed    int64
+	Critical    bool
+	Glancing    bool
+	Crushing    bool
+	OffHand     bool `combatlog:"optional"`
 }
 func (d Damage) GetDamage() Damage {
 	return d
@@ -57,8 +111,11 @@ func (h Heal) GetHeal() Heal {
 }
 
 type Miss struct {
-	Type    string
-	Unknown int64  `combatlog:"optional"`
+	Type        MissType
+	OffHand     bool  `combatlog:"modern"`
+	Unknown     int64 `combatlog:"optional"` // the amount absorbed, blocked or resisted
+	Unmitigated int64 `combatlog:"modern"`
+	Critical    bool  `combatlog:"modern"`
 }
 
 type Shield struct {
@@ -68,7 +125,7 @@ type Shield struct {
 }
 
 type Aura struct {
-	Type   string
+	Type   AuraType
 	Shield       `combatlog:"optional"`
 }
 
@@ -79,19 +136,42 @@ type Power struct {
 
 type Item struct {
 	ID   int64
-	Item string
+	Item string `combatlog:"quoted"`
+}
+
+// COMBAT_LOG_VERSION
+//
+// This is written by newer clients at the start of every log and whenever
+// logging is restarted.  It is decoded by the Reader itself rather than by an
+// eventFactory, because it is a list of key/value pairs.  The events after it
+// have the fields added by newer clients (such as Damage.Unmitigated), and an
+// Advanced block if Advanced is set.
+type LogVersion struct {
+	Version   int
+	Advanced  bool
+	Build     string
+	ProjectID int
+}
+
+// RawEvent holds an event whose name is not known to the package, such as
+// one added by a newer client.  The fields are exactly as they appear in the
+// log, so strings are still quoted.
+type RawEvent struct {
+	Name   string
+	Fields []string
 }
 
 // ENVIRONMENTAL_DAMAGE
 type EnvironmentalDamage struct {
 	Common
-	Type   string
+	Type   EnvironmentType
 	Damage
 }
 
 // SWING_DAMAGE
 type SwingDamage struct {
 	Common
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -105,6 +185,7 @@ type SwingMissed struct {
 type RangeDamage struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -125,13 +206,14 @@ type SpellCastStart struct {
 type SpellCastSuccess struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 }
 
 // SPELL_CAST_FAILED
 type SpellCastFailed struct {
 	Common
 	Spell
-	Miss
+	Reason string `combatlog:"quoted"`
 }
 
 // SPELL_MISSED
@@ -145,6 +227,7 @@ type SpellMissed struct {
 type SpellDamage struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -152,6 +235,7 @@ type SpellDamage struct {
 type SpellBuildingDamage struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -159,6 +243,7 @@ type SpellBuildingDamage struct {
 type SpellHeal struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Heal
 }
 
@@ -166,6 +251,7 @@ type SpellHeal struct {
 type SpellEnergize struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Power
 }
 
@@ -173,6 +259,7 @@ type SpellEnergize struct {
 type SpellDrain struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Power
 	Drained int64
 }
@@ -181,6 +268,7 @@ type SpellDrain struct {
 type SpellLeech struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Power
 	Leeched int64
 }
@@ -295,14 +383,14 @@ type SpellStolen struct {
 // ENCHANT_APPLIED	
 type EnchantApplied struct {
 	Common
-	Enchant string
+	Enchant string `combatlog:"quoted"`
 	Item
 }
 
 // ENCHANT_REMOVED	
 type EnchantRemoved struct {
 	Common
-	Enchant string
+	Enchant string `combatlog:"quoted"`
 	Item
 }
 
@@ -317,6 +405,7 @@ type SpellPeriodicMissed struct {
 type SpellPeriodicDamage struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -324,6 +413,7 @@ type SpellPeriodicDamage struct {
 type SpellPeriodicHeal struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Heal
 }
 
@@ -331,6 +421,7 @@ type SpellPeriodicHeal struct {
 type SpellPeriodicEnergize struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Power
 }
 
@@ -338,6 +429,7 @@ type SpellPeriodicEnergize struct {
 type SpellPeriodicDrain struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Power
 	Drained int64
 }
@@ -346,6 +438,7 @@ type SpellPeriodicDrain struct {
 type SpellPeriodicLeech struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Power
 	Leeched int64
 }
@@ -361,6 +454,7 @@ type SpellDispelFailed struct {
 type DamageShield struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -375,6 +469,7 @@ type DamageShieldMissed struct {
 type DamageSplit struct {
 	Common
 	Spell
+	Advanced `combatlog:"advanced"`
 	Damage
 }
 
@@ -411,6 +506,25 @@ type UnitDestroyed struct {
 	Common
 }
 
+// ENCOUNTER_START
+type EncounterStart struct {
+	EncounterID   int64
+	EncounterName string `combatlog:"quoted"`
+	DifficultyID  int64
+	GroupSize     int64
+	InstanceID    int64 `combatlog:"optional"`
+}
+
+// ENCOUNTER_END
+type EncounterEnd struct {
+	EncounterID   int64
+	EncounterName string `combatlog:"quoted"`
+	DifficultyID  int64
+	GroupSize     int64
+	Success       bool  `combatlog:"zero"`
+	FightTime     int64 `combatlog:"optional"` // milliseconds
+}
+
 var eventTypes = map[string]eventFactory{
 	"ENVIRONMENTAL_DAMAGE":        compile(&EnvironmentalDamage{}),
 	"SWING_DAMAGE":                compile(&SwingDamage{}),
@@ -460,4 +574,6 @@ var eventTypes = map[string]eventFactory{
 	"PARTY_KILL":                  compile(&PartyKill{}),
 	"UNIT_DIED":                   compile(&UnitDied{}),
 	"UNIT_DESTROYED":              compile(&UnitDestroyed{}),
+	"ENCOUNTER_START":             compile(&EncounterStart{}),
+	"ENCOUNTER_END":               compile(&EncounterEnd{}),
 }
@@ -0,0 +1,172 @@
+package combatlog
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Magic numbers at the start of compressed logs
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// ArchivePattern matches the names of the logs read from a zip archive.
+// Other files in the archive are ignored.
+const ArchivePattern = "WoWCombatLog*.txt"
+
+// openLog opens the named log, decompressing it if it is compressed with
+// gzip, bzip2 or zstd or is a zip archive.  The returned name is that of the
+// (first) uncompressed log, from which the start of the log can be parsed.
+func openLog(filename string) (r io.Reader, closer io.Closer, name string, err os.Error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// Shorter files can't be compressed, so the error doesn't matter
+	var magic [4]byte
+	n, _ := file.ReadAt(magic[:], 0)
+	head := magic[:n]
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		z, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, "", err
+		}
+		return z, multiCloser{z, file}, trimExt(filename, ".gz"), nil
+	case bytes.HasPrefix(head, bzip2Magic):
+		return bzip2.NewReader(file), file, trimExt(filename, ".bz2"), nil
+	case bytes.HasPrefix(head, zstdMagic):
+		return newZstdReader(file), file, trimExt(filename, ".zst"), nil
+	case bytes.HasPrefix(head, zipMagic):
+		a, err := openArchive(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, "", err
+		}
+		return a, a, a.files[0].Name, nil
+	}
+	return file, file, filename, nil
+}
+
+// trimExt removes ext from the end of name, if it is there.
+func trimExt(name, ext string) string {
+	if strings.HasSuffix(name, ext) {
+		return name[:len(name)-len(ext)]
+	}
+	return name
+}
+
+// A multiCloser closes each of its Closers in order, returning the first
+// error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() (err os.Error) {
+	for _, c := range m {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// An archiveReader reads the logs in a zip archive one after another, in the
+// order in which they were started.  A newline is inserted after each log in
+// case it does not end with one.
+type archiveReader struct {
+	file  *os.File
+	files []*zip.File // the logs which have not been opened yet
+	cur   io.ReadCloser
+	sep   bool // whether the newline after the last log is still to be read
+}
+
+func openArchive(file *os.File) (*archiveReader, os.Error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	z, err := zip.NewReader(file, fi.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archiveReader{file: file}
+	for _, f := range z.File {
+		if ok, _ := filepath.Match(ArchivePattern, path.Base(f.Name)); ok {
+			a.files = append(a.files, f)
+		}
+	}
+	if len(a.files) == 0 {
+		return nil, os.NewError("combatlog: " + file.Name() + ": no logs matching " + ArchivePattern + " in archive")
+	}
+	sort.Sort(byLogStart(a.files))
+	return a, nil
+}
+
+func (a *archiveReader) Read(p []byte) (n int, err os.Error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if a.sep {
+		p[0] = '\n'
+		a.sep = false
+		return 1, nil
+	}
+	if a.cur == nil {
+		if len(a.files) == 0 {
+			return 0, os.EOF
+		}
+		if a.cur, err = a.files[0].Open(); err != nil {
+			return 0, err
+		}
+		a.files = a.files[1:]
+	}
+
+	n, err = a.cur.Read(p)
+	if err == os.EOF {
+		// The log may have ended with data and no newline, so the newline
+		// is returned by the next call.
+		err = a.cur.Close()
+		a.cur = nil
+		a.sep = true
+		if n == 0 && err == nil {
+			return a.Read(p)
+		}
+	}
+	return n, err
+}
+
+func (a *archiveReader) Close() os.Error {
+	if a.cur != nil {
+		a.cur.Close()
+	}
+	return a.file.Close()
+}
+
+// byLogStart sorts logs by the time in their names, or by name if it cannot
+// be parsed.
+type byLogStart []*zip.File
+
+func (s byLogStart) Len() int      { return len(s) }
+func (s byLogStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLogStart) Less(i, j int) bool {
+	ti, oki := ParseLogName(s[i].Name)
+	tj, okj := ParseLogName(s[j].Name)
+	if oki && okj {
+		return ti.Seconds() < tj.Seconds()
+	}
+	return s[i].Name < s[j].Name
+}
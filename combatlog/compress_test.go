@@ -0,0 +1,146 @@
+package combatlog
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tempLog writes a log to a temporary file with write and returns its name.
+func tempLog(t *testing.T, write func(io.Writer) os.Error) string {
+	f, err := ioutil.TempFile("", "combatlog")
+	if err != nil {
+		t.Fatalf("tempfile: %s", err)
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		os.Remove(f.Name())
+		t.Fatalf("write %s: %s", f.Name(), err)
+	}
+	return f.Name()
+}
+
+func TestReadFileGzip(t *testing.T) {
+	test := decodeTests[0]
+	name := tempLog(t, func(w io.Writer) os.Error {
+		z, err := gzip.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		io.WriteString(z, test.Lines)
+		return z.Close()
+	})
+	defer os.Remove(name)
+
+	cl, err := ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if got, want := len(cl), len(test.Events); got != want {
+		t.Fatalf("got %d events, want %d", got, want)
+	}
+	for i := range cl {
+		if got, want := cl[i].Data, test.Events[i].Data; !reflect.DeepEqual(got, want) {
+			t.Errorf("event %d:\n got: %#v\nwant: %#v", i, got, want)
+		}
+	}
+}
+
+func TestReadFileZip(t *testing.T) {
+	// Logs are read in the order they were started, not archive order, and
+	// are not joined together even though they don't end with a newline.
+	logs := []struct{ Name, Lines string }{
+		{"logs/WoWCombatLog-101823_203000.txt", strings.Trim(decodeTests[1].Lines, "\n")},
+		{"README.txt", "not a log"},
+		{"logs/WoWCombatLog-101723_190000.txt", strings.Trim(decodeTests[0].Lines, "\n")},
+	}
+	name := tempLog(t, func(w io.Writer) os.Error {
+		z := zip.NewWriter(w)
+		for _, log := range logs {
+			f, err := z.Create(log.Name)
+			if err != nil {
+				return err
+			}
+			io.WriteString(f, log.Lines)
+		}
+		return z.Close()
+	})
+	defer os.Remove(name)
+
+	cl, err := ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	want := append(append(CombatLog{}, decodeTests[0].Events...), decodeTests[1].Events...)
+	if got, want := len(cl), len(want); got != want {
+		t.Fatalf("got %d events, want %d", got, want)
+	}
+	for i := range cl {
+		if got, want := cl[i].Data, want[i].Data; !reflect.DeepEqual(got, want) {
+			t.Errorf("event %d:\n got: %#v\nwant: %#v", i, got, want)
+		}
+	}
+	if got, want := cl[0].Time.Year, int64(2023); got != want {
+		t.Errorf("year = %d, want %d", got, want)
+	}
+}
+
+// zstdLog is decodeTests[0].Lines compressed by the zstd command at level 19,
+// with a content checksum.
+const zstdLog = "" +
+	"\x28\xb5\x2f\xfd\x64\x58\x00\x1d\x06\x00\x92\x0b\x26\x19\x40\x79" +
+	"\x03\x54\x16\x00\x83\x09\x4e\x0f\x01\x38\x41\x00\x09\x15\x1c\xc6" +
+	"\x28\xfd\x59\x14\xe3\xee\x05\x6e\xef\xb5\xe6\xd6\xe2\xe6\xb4\x70" +
+	"\x2f\x81\x37\x39\xe3\xe3\x46\xd7\xa4\xdd\xe3\x07\x83\x1c\xcb\xf7" +
+	"\xc2\x70\x2b\x38\x92\xfc\xf5\x2f\xc8\x51\x37\x55\x3c\xb9\xcf\x09" +
+	"\x3c\xdb\xc7\xf8\xd8\x7a\x6f\x2d\xd5\xb3\xfc\x48\xf4\x34\x51\x2c" +
+	"\xf0\xec\x20\x4b\xc6\xff\xc6\x92\x91\xbf\x9f\xbe\x27\x96\x4b\xdf" +
+	"\x83\xcf\xe3\x48\xa6\x96\xba\x7b\xea\x27\x9e\x15\xd4\xf5\x14\xc3" +
+	"\xb1\xa4\x02\xb7\x49\x46\x3e\x63\x9c\xdf\xb0\x50\xfa\xfe\x44\x8b" +
+	"\xb5\x38\x5b\x55\x3d\x58\x56\xab\xbd\x79\x28\x0a\xc5\x78\x25\xdb" +
+	"\x7a\x0b\x22\x03\x01\x10\x20\xf0\x82\x8a\x2e\x3c\x1d\x1c\x7b\xb0" +
+	"\x86\x6e\x89\x29\xb4\x63\xc7\x62\x70\x39\x40\x81\x3c\x61\xd1\x90" +
+	"\x57\x83\x16\x7c\x04\xe6\xf7\xb2\xb7\x85\xc0\xd5\x03\xcf\x93\x8d" +
+	"\xec"
+
+func TestReadFileZstd(t *testing.T) {
+	test := decodeTests[0]
+	name := tempLog(t, func(w io.Writer) os.Error {
+		_, err := io.WriteString(w, zstdLog)
+		return err
+	})
+	defer os.Remove(name)
+
+	cl, err := ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if got, want := len(cl), len(test.Events); got != want {
+		t.Fatalf("got %d events, want %d", got, want)
+	}
+	for i := range cl {
+		if got, want := cl[i].Data, test.Events[i].Data; !reflect.DeepEqual(got, want) {
+			t.Errorf("event %d:\n got: %#v\nwant: %#v", i, got, want)
+		}
+	}
+}
+
+func TestReadFileZstdChecksum(t *testing.T) {
+	name := tempLog(t, func(w io.Writer) os.Error {
+		// Corrupt the last byte of the checksum
+		log := []byte(zstdLog)
+		log[len(log)-1] ^= 0xff
+		_, err := w.Write(log)
+		return err
+	})
+	defer os.Remove(name)
+
+	if _, err := ReadFile(name); err == nil || !strings.Contains(err.String(), "checksum") {
+		t.Errorf("ReadFile(corrupt zstd) = %v, want checksum error", err)
+	}
+}
@@ -1,29 +1,150 @@
 package combatlog
 
 import (
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
 )
 
+// UnitFlags describe a unit relative to the player who wrote the log.  They
+// are the COMBATLOG_OBJECT_* flags from the client.
 type UnitFlags uint64
 const (
-	UnitSelf UnitFlags = 0x1
-	UnitParty UnitFlags = 0x2
-	UnitRaid UnitFlags = 0x4
-	UnitEnemy UnitFlags = 0x40
+	// Affiliation
+	UnitMine     UnitFlags = 0x00000001
+	UnitParty    UnitFlags = 0x00000002
+	UnitRaid     UnitFlags = 0x00000004
+	UnitOutsider UnitFlags = 0x00000008
+
+	// Reaction
+	UnitFriendly UnitFlags = 0x00000010
+	UnitNeutral  UnitFlags = 0x00000020
+	UnitHostile  UnitFlags = 0x00000040
+
+	// Control
+	UnitControlPlayer UnitFlags = 0x00000100
+	UnitControlNPC    UnitFlags = 0x00000200
+
+	// Type
+	UnitTypePlayer   UnitFlags = 0x00000400
+	UnitTypeNPC      UnitFlags = 0x00000800
+	UnitTypePet      UnitFlags = 0x00001000
+	UnitTypeGuardian UnitFlags = 0x00002000
+	UnitTypeObject   UnitFlags = 0x00004000
+
+	// Special
+	UnitTarget     UnitFlags = 0x00010000
+	UnitFocus      UnitFlags = 0x00020000
+	UnitMainTank   UnitFlags = 0x00040000
+	UnitMainAssist UnitFlags = 0x00080000
+	UnitNone       UnitFlags = 0x80000000
+
+	UnitAffiliationMask UnitFlags = 0x0000000F
+	UnitReactionMask    UnitFlags = 0x000000F0
+	UnitControlMask     UnitFlags = 0x00000300
+	UnitTypeMask        UnitFlags = 0x0000FC00
+	UnitSpecialMask     UnitFlags = 0xFFFF0000
+
+	// Older names
+	UnitSelf  = UnitMine
+	UnitEnemy = UnitHostile
 )
+var unitFlagNames = []struct {
+	flag UnitFlags
+	name string
+}{
+	{UnitMine, "Mine"},
+	{UnitParty, "Party"},
+	{UnitRaid, "Raid"},
+	{UnitOutsider, "Outsider"},
+	{UnitFriendly, "Friendly"},
+	{UnitNeutral, "Neutral"},
+	{UnitHostile, "Hostile"},
+	{UnitControlPlayer, "ControlPlayer"},
+	{UnitControlNPC, "ControlNPC"},
+	{UnitTypePlayer, "Player"},
+	{UnitTypeNPC, "NPC"},
+	{UnitTypePet, "Pet"},
+	{UnitTypeGuardian, "Guardian"},
+	{UnitTypeObject, "Object"},
+	{UnitTarget, "Target"},
+	{UnitFocus, "Focus"},
+	{UnitMainTank, "MainTank"},
+	{UnitMainAssist, "MainAssist"},
+	{UnitNone, "None"},
+}
 func (f UnitFlags) String() string {
 	flags := []string{}
-	if f | UnitSelf != 0 {
-		flags = append(flags, "Self")
+	for _, n := range unitFlagNames {
+		if f&n.flag != 0 {
+			flags = append(flags, n.name)
+			f &^= n.flag
+		}
 	}
-	if f | UnitParty != 0 {
-		flags = append(flags, "Party")
+	if f != 0 {
+		flags = append(flags, "0x"+strconv.Uitob64(uint64(f), 16))
 	}
-	if f | UnitRaid != 0 {
-		flags = append(flags, "Raid")
+	return strings.Join(flags, "|")
+}
+
+// Has returns true if all of the given flags are set.
+func (f UnitFlags) Has(flags UnitFlags) bool { return f&flags == flags }
+
+func (f UnitFlags) IsMine() bool     { return f&UnitMine != 0 }
+func (f UnitFlags) InParty() bool    { return f&UnitParty != 0 }
+func (f UnitFlags) InRaid() bool     { return f&UnitRaid != 0 }
+func (f UnitFlags) IsOutsider() bool { return f&UnitOutsider != 0 }
+
+// InGroup returns true if the unit is the player or in their party or raid.
+func (f UnitFlags) InGroup() bool { return f&(UnitMine|UnitParty|UnitRaid) != 0 }
+
+func (f UnitFlags) IsFriendly() bool { return f&UnitFriendly != 0 }
+func (f UnitFlags) IsNeutral() bool  { return f&UnitNeutral != 0 }
+func (f UnitFlags) IsHostile() bool  { return f&UnitHostile != 0 }
+
+func (f UnitFlags) PlayerControlled() bool { return f&UnitControlPlayer != 0 }
+func (f UnitFlags) NPCControlled() bool    { return f&UnitControlNPC != 0 }
+
+func (f UnitFlags) IsPlayer() bool   { return f&UnitTypePlayer != 0 }
+func (f UnitFlags) IsNPC() bool      { return f&UnitTypeNPC != 0 }
+func (f UnitFlags) IsPet() bool      { return f&UnitTypePet != 0 }
+func (f UnitFlags) IsGuardian() bool { return f&UnitTypeGuardian != 0 }
+func (f UnitFlags) IsObject() bool   { return f&UnitTypeObject != 0 }
+
+func (f UnitFlags) IsTarget() bool     { return f&UnitTarget != 0 }
+func (f UnitFlags) IsFocus() bool      { return f&UnitFocus != 0 }
+func (f UnitFlags) IsMainTank() bool   { return f&UnitMainTank != 0 }
+func (f UnitFlags) IsMainAssist() bool { return f&UnitMainAssist != 0 }
+
+// RaidFlags are the second set of flags on a unit, which hold the raid
+// target marker (the COMBATLOG_OBJECT_RAIDTARGET* flags).
+type RaidFlags uint32
+const (
+	RaidStar RaidFlags = 1 << iota
+	RaidCircle
+	RaidDiamond
+	RaidTriangle
+	RaidMoon
+	RaidSquare
+	RaidCross
+	RaidSkull
+
+	RaidTargetMask RaidFlags = 0xFF
+)
+var raidFlagNames = [...]string{
+	"Star", "Circle", "Diamond", "Triangle", "Moon", "Square", "Cross", "Skull",
+}
+func (f RaidFlags) String() string {
+	flags := []string{}
+	for i, name := range raidFlagNames {
+		if bit := RaidFlags(1) << uint(i); f&bit != 0 {
+			flags = append(flags, name)
+			f &^= bit
+		}
 	}
-	if f | UnitEnemy != 0 {
-		flags = append(flags, "Enemy")
+	if f != 0 {
+		flags = append(flags, "0x"+strconv.Uitob64(uint64(f), 16))
 	}
 	return strings.Join(flags, "|")
 }
@@ -37,20 +158,74 @@ const (
 	SchoolFrost
 	SchoolShadow
 	SchoolArcane
+
+	SchoolElemental = SchoolFire | SchoolNature | SchoolFrost
+	SchoolChromatic = SchoolElemental | SchoolShadow | SchoolArcane
+	SchoolMagic     = SchoolHoly | SchoolChromatic
+	SchoolChaos     = SchoolPhysical | SchoolMagic
 )
 var schoolNames = [...]string{
 	"Physical", "Holy", "Fire", "Nature", "Frost", "Shadow", "Arcane",
 }
+// Names of the combined schools
+var multiSchoolNames = map[SpellSchool]string{
+	SchoolPhysical | SchoolHoly:   "Holystrike",
+	SchoolPhysical | SchoolFire:   "Flamestrike",
+	SchoolPhysical | SchoolNature: "Stormstrike",
+	SchoolPhysical | SchoolFrost:  "Froststrike",
+	SchoolPhysical | SchoolShadow: "Shadowstrike",
+	SchoolPhysical | SchoolArcane: "Spellstrike",
+	SchoolHoly | SchoolFire:       "Holyfire",
+	SchoolHoly | SchoolNature:     "Holystorm",
+	SchoolHoly | SchoolFrost:      "Holyfrost",
+	SchoolHoly | SchoolShadow:     "Twilight",
+	SchoolHoly | SchoolArcane:     "Divine",
+	SchoolFire | SchoolNature:     "Firestorm",
+	SchoolFire | SchoolFrost:      "Frostfire",
+	SchoolFire | SchoolShadow:     "Shadowflame",
+	SchoolFire | SchoolArcane:     "Spellfire",
+	SchoolNature | SchoolFrost:    "Froststorm",
+	SchoolNature | SchoolShadow:   "Plague",
+	SchoolNature | SchoolArcane:   "Astral",
+	SchoolFrost | SchoolShadow:    "Shadowfrost",
+	SchoolFrost | SchoolArcane:    "Spellfrost",
+	SchoolShadow | SchoolArcane:   "Spellshadow",
+
+	SchoolElemental: "Elemental",
+	SchoolChromatic: "Chromatic",
+	SchoolMagic:     "Magic",
+	SchoolChaos:     "Chaos",
+}
+// String returns the name of the school, which may be a combined school
+// such as "Frostfire".  Unnamed combinations are separated by slashes.
 func (s SpellSchool) String() string {
+	if name, ok := multiSchoolNames[s]; ok {
+		return name
+	}
 	schools := []string{}
 	for i, name := range schoolNames {
-		if s | (1 << uint(i)) != 0 {
+		if s&(1<<uint(i)) != 0 {
 			schools = append(schools, name)
 		}
 	}
 	return strings.Join(schools, "/")
 }
 
+// Has returns true if s includes all of the given schools.
+func (s SpellSchool) Has(schools SpellSchool) bool {
+	return s&schools == schools
+}
+
+// Schools returns the basic schools which make up s.
+func (s SpellSchool) Schools() (schools []SpellSchool) {
+	for i := range schoolNames {
+		if bit := SpellSchool(1) << uint(i); s&bit != 0 {
+			schools = append(schools, bit)
+		}
+	}
+	return schools
+}
+
 type PowerType int32
 const (
 	PowerHealth = -2
@@ -81,29 +256,96 @@ func (p PowerType) String() string {
 	return "Unknown"
 }
 
+// enumName returns the readable name of an enum value such as "PARRY" or
+// "FALLING", which is the value in title case.
+func enumName(value string) string {
+	if len(value) == 0 {
+		return ""
+	}
+	return value[:1] + strings.ToLower(value[1:])
+}
+
+// validateEnum checks that value is known, ignoring case, and returns it
+// normalized to upper case.  The known function is given the upper case
+// value and reports whether it is one of the enum's constants.
+func validateEnum(value string, known func(upper string) bool) (string, os.Error) {
+	upper := strings.ToUpper(value)
+	if !known(upper) {
+		return value, fmt.Errorf("unknown value %q", value)
+	}
+	return upper, nil
+}
+
+// MissType is the reason an attack or spell did not (fully) land.
+type MissType string
 const (
-	MissMiss = "MISS"
-	MissAbsorb = "ABSORB"
-	MissBlock = "BLOCK"
-	MissDeflect = "DEFLECT"
-	MissDodge = "DODGE"
-	MissEvade = "EVADE"
-	MissImmune = "IMMUNE"
-	MissParry = "PARRY"
-	MissReflect = "REFLECT"
-	MissResist = "RESIST"
+	MissMiss    MissType = "MISS"
+	MissAbsorb  MissType = "ABSORB"
+	MissBlock   MissType = "BLOCK"
+	MissDeflect MissType = "DEFLECT"
+	MissDodge   MissType = "DODGE"
+	MissEvade   MissType = "EVADE"
+	MissImmune  MissType = "IMMUNE"
+	MissParry   MissType = "PARRY"
+	MissReflect MissType = "REFLECT"
+	MissResist  MissType = "RESIST"
 )
+var missTypes = []MissType{
+	MissMiss, MissAbsorb, MissBlock, MissDeflect, MissDodge,
+	MissEvade, MissImmune, MissParry, MissReflect, MissResist,
+}
+func (m MissType) String() string { return enumName(string(m)) }
+func (MissType) validate(fstr string) (string, os.Error) {
+	return validateEnum(fstr, func(upper string) bool {
+		for _, m := range missTypes {
+			if upper == string(m) {
+				return true
+			}
+		}
+		return false
+	})
+}
 
+// AuraType distinguishes buffs from debuffs.
+type AuraType string
 const (
-	AuraBuff = "BUFF"
-	AuraDebuff = "DEBUFF"
+	AuraBuff   AuraType = "BUFF"
+	AuraDebuff AuraType = "DEBUFF"
 )
+var auraTypes = []AuraType{AuraBuff, AuraDebuff}
+func (a AuraType) String() string { return enumName(string(a)) }
+func (AuraType) validate(fstr string) (string, os.Error) {
+	return validateEnum(fstr, func(upper string) bool {
+		for _, a := range auraTypes {
+			if upper == string(a) {
+				return true
+			}
+		}
+		return false
+	})
+}
 
+// EnvironmentType is the source of environmental damage.
+type EnvironmentType string
 const (
-	EnvDrowning = "DROWNING"
-	EnvFalling = "FALLING"
-	EnvFatigue = "FATIGUE"
-	EnvFire = "FIRE"
-	EnvLava = "LAVA"
-	EnvSlime = "SLIME"
+	EnvDrowning EnvironmentType = "DROWNING"
+	EnvFalling  EnvironmentType = "FALLING"
+	EnvFatigue  EnvironmentType = "FATIGUE"
+	EnvFire     EnvironmentType = "FIRE"
+	EnvLava     EnvironmentType = "LAVA"
+	EnvSlime    EnvironmentType = "SLIME"
 )
+var environmentTypes = []EnvironmentType{
+	EnvDrowning, EnvFalling, EnvFatigue, EnvFire, EnvLava, EnvSlime,
+}
+func (e EnvironmentType) String() string { return enumName(string(e)) }
+func (EnvironmentType) validate(fstr string) (string, os.Error) {
+	return validateEnum(fstr, func(upper string) bool {
+		for _, e := range environmentTypes {
+			if upper == string(e) {
+				return true
+			}
+		}
+		return false
+	})
+}
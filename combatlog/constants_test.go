@@ -0,0 +1,118 @@
+package combatlog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var unitFlagsTests = []struct {
+	Flags  UnitFlags
+	String string
+}{
+	{0x511, "Mine|Friendly|ControlPlayer|Player"},
+	{0xa48, "Outsider|Hostile|ControlNPC|NPC"},
+	{0x1114, "Raid|Friendly|ControlPlayer|Pet"},
+	{0x80000000, "None"},
+	{0x100000, "0x100000"},
+	{0, ""},
+}
+
+func TestUnitFlags(t *testing.T) {
+	for _, test := range unitFlagsTests {
+		if got, want := test.Flags.String(), test.String; got != want {
+			t.Errorf("UnitFlags(%#x).String() = %q, want %q", uint64(test.Flags), got, want)
+		}
+	}
+
+	var f UnitFlags = 0xa48
+	if !f.IsHostile() || !f.IsNPC() || f.IsPlayer() || f.InGroup() {
+		t.Errorf("UnitFlags(0xa48): got hostile=%v npc=%v player=%v group=%v, want true true false false",
+			f.IsHostile(), f.IsNPC(), f.IsPlayer(), f.InGroup())
+	}
+}
+
+func TestRaidFlags(t *testing.T) {
+	u := Unit{Flag2: RaidSkull | 0x80000000}
+	if got, want := u.RaidMarker(), RaidSkull; got != want {
+		t.Errorf("RaidMarker() = %s, want %s", got, want)
+	}
+	if got, want := u.Flag2.String(), "Skull|0x80000000"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := RaidFlags(0x11).String(), "Star|Moon"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+var spellSchoolTests = []struct {
+	School SpellSchool
+	String string
+	Count  int
+}{
+	{SchoolFire, "Fire", 1},
+	{SchoolFire | SchoolFrost, "Frostfire", 2},
+	{SchoolFire | SchoolShadow, "Shadowflame", 2},
+	{SchoolChaos, "Chaos", 7},
+	{SchoolPhysical | SchoolFire | SchoolFrost, "Physical/Fire/Frost", 3},
+}
+
+func TestSpellSchool(t *testing.T) {
+	for _, test := range spellSchoolTests {
+		if got, want := test.School.String(), test.String; got != want {
+			t.Errorf("SpellSchool(%d).String() = %q, want %q", test.School, got, want)
+		}
+		if got, want := len(test.School.Schools()), test.Count; got != want {
+			t.Errorf("SpellSchool(%d).Schools() has %d schools, want %d", test.School, got, want)
+		}
+	}
+	if !SchoolChaos.Has(SchoolFire|SchoolFrost) || SchoolMagic.Has(SchoolPhysical) {
+		t.Errorf("Has: got %v, %v, want true, false", SchoolChaos.Has(SchoolFire|SchoolFrost), SchoolMagic.Has(SchoolPhysical))
+	}
+}
+
+func TestMissType(t *testing.T) {
+	const line = `9/25 19:03:23.045  SWING_MISSED,0xF15096640000699C,"Argent Warhorse",0xa18,0x0,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0,`
+
+	cl, err := Read(bytes.NewBufferString(line + "parry\n"))
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	miss := cl[0].Data.(SwingMissed)
+	if miss.Type != MissParry {
+		t.Errorf("miss type = %q, want %q", miss.Type, MissParry)
+	}
+	if got, want := miss.Type.String(), "Parry"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if _, err := Read(bytes.NewBufferString(line + "FUMBLE\n")); err == nil {
+		t.Errorf("read of unknown miss type succeeded")
+	}
+
+	// Cast failures have a reason instead
+	const failed = `10/18 20:30:02.000  SPELL_CAST_FAILED,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,0000000000000000,nil,0x80000000,0x80000000,133,"Fireball",0x4,"Not yet recovered"`
+	cl, err = Read(bytes.NewBufferString(failed + "\n"))
+	if err != nil {
+		t.Fatalf("read cast failure: %s", err)
+	}
+	if got, want := cl[0].Data.(SpellCastFailed).Reason, "Not yet recovered"; got != want {
+		t.Errorf("cast failure reason = %q, want %q", got, want)
+	}
+
+	// and are written back in quotes
+	buf := new(bytes.Buffer)
+	if err := Write(buf, cl); err != nil {
+		t.Fatalf("write cast failure: %s", err)
+	}
+	if got, want := buf.String(), failed+"\n"; got != want {
+		t.Errorf("wrote cast failure:\n%s\nwant:\n%s", got, want)
+	}
+	reread, err := Read(buf)
+	if err != nil {
+		t.Fatalf("reread cast failure: %s", err)
+	}
+	if !reflect.DeepEqual(reread, cl) {
+		t.Errorf("reread cast failure = %#v, want %#v", reread[0].Data, cl[0].Data)
+	}
+}
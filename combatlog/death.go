@@ -0,0 +1,93 @@
+package combatlog
+
+import (
+	"time"
+)
+
+// DeathWindow is the default length of time, in nanoseconds, covered by a
+// DeathRecap.
+const DeathWindow = 10e9
+
+// A DeathRecap describes what happened to a unit in the time leading up to
+// its death.
+type DeathRecap struct {
+	Unit Unit
+	Time time.Time
+
+	// Events holds the damage taken, healing received and auras applied to
+	// or removed from the unit during the window, in order.
+	Events CombatLog
+
+	// KillingBlow points to the last damage taken in Events.  It is nil if
+	// the unit took no damage during the window.
+	KillingBlow *Event
+
+	DamageTaken     int64
+	HealingReceived int64 // excludes overhealing
+}
+
+// Overkill returns the overkill of the killing blow, or 0 if unknown.
+func (d DeathRecap) Overkill() int64 {
+	if d.KillingBlow == nil {
+		return 0
+	}
+	if o := d.KillingBlow.Data.(damaged).GetDamage().Overkill; o > 0 {
+		return int64(o)
+	}
+	return 0
+}
+
+// Deaths returns a recap for the death of every unit in the player's group,
+// covering the window nanoseconds before each death.
+func (cl CombatLog) Deaths(window int64) (recaps []DeathRecap) {
+	for i := range cl {
+		died, ok := cl[i].Data.(UnitDied)
+		if !ok || !died.Dest.Flags.InGroup() {
+			continue
+		}
+		recaps = append(recaps, cl.recap(i, died.Dest, window))
+	}
+	return recaps
+}
+
+// recap builds the DeathRecap for unit, which died at cl[idx].
+func (cl CombatLog) recap(idx int, unit Unit, window int64) DeathRecap {
+	d := DeathRecap{
+		Unit: unit,
+		Time: cl[idx].Time,
+	}
+
+	cutoff := cl[idx].Time.Nanoseconds() - window
+	first := idx
+	for first > 0 && cl[first-1].Time.Nanoseconds() >= cutoff {
+		first--
+	}
+
+	for i := first; i < idx; i++ {
+		e := &cl[i]
+		p, ok := e.Data.(participants)
+		if !ok || p.GetDest().ID != unit.ID {
+			continue
+		}
+
+		switch data := e.Data.(type) {
+		case damaged:
+			d.DamageTaken += data.GetDamage().Amount
+		case healed:
+			heal := data.GetHeal()
+			d.HealingReceived += heal.Amount - heal.Overheal
+		case SpellAuraApplied, SpellAuraRemoved, SpellAuraAppliedDose, SpellAuraRemovedDose:
+		default:
+			continue
+		}
+		d.Events = append(d.Events, *e)
+	}
+
+	for i := len(d.Events) - 1; i >= 0; i-- {
+		if _, ok := d.Events[i].Data.(damaged); ok {
+			d.KillingBlow = &d.Events[i]
+			break
+		}
+	}
+	return d
+}
@@ -0,0 +1,84 @@
+package combatlog
+
+import (
+	"testing"
+)
+
+func overkill(e Event, overkill int32) Event {
+	swing := e.Data.(SwingDamage)
+	swing.Overkill = overkill
+	e.Data = swing
+	return e
+}
+
+func TestDeaths(t *testing.T) {
+	healer := Unit{ID: "Player-1-00000002", Name: "Healer", Flags: UnitRaid}
+	tank := Unit{ID: "Player-1-00000003", Name: "Tank", Flags: UnitParty}
+
+	cl := CombatLog{
+		hit(at(0, 0), testBoss, testRaider, 500), // before the window
+		heal(6, healer, testRaider, 400, 100),
+		{Time: at(0, 7), Name: "SPELL_AURA_APPLIED", Data: SpellAuraApplied{
+			Common: Common{Source: testBoss, Dest: testRaider},
+			Spell:  Spell{ID: 1, Name: "Doom"},
+			Aura:   Aura{Type: AuraDebuff},
+		}},
+		overkill(hit(at(0, 8), testBoss, testRaider, 1000), 200),
+		hit(at(0, 9), testRaider, testAdd, 50), // not taken by the raider
+		died(at(0, 10), testRaider),
+
+		// Dies without taking damage
+		heal(18, healer, healer, 100, 100),
+		died(at(0, 20), healer),
+
+		// Overkill not known
+		overkill(hit(at(0, 25), testBoss, tank, 900), -1),
+		died(at(0, 26), tank),
+
+		// Not in the group
+		died(at(0, 30), testBoss),
+	}
+
+	recaps := cl.Deaths(5e9)
+	if got, want := len(recaps), 3; got != want {
+		t.Fatalf("got %d deaths, want %d", got, want)
+	}
+
+	r := recaps[0]
+	if r.Unit.ID != testRaider.ID || r.Time.Second != 10 {
+		t.Errorf("death 0 = %s at %d, want %s at 10", r.Unit.Name, r.Time.Second, testRaider.Name)
+	}
+	if got, want := len(r.Events), 3; got != want {
+		t.Fatalf("death 0: got %d events, want %d", got, want)
+	}
+	for i, want := range []string{"SPELL_HEAL", "SPELL_AURA_APPLIED", "SWING_DAMAGE"} {
+		if got := r.Events[i].Name; got != want {
+			t.Errorf("death 0: event %d = %s, want %s", i, got, want)
+		}
+	}
+	if r.KillingBlow != &r.Events[2] {
+		t.Errorf("death 0: killing blow = %#v, want the last event", r.KillingBlow)
+	}
+	if r.DamageTaken != 1000 || r.HealingReceived != 300 {
+		t.Errorf("death 0: took %d damage and %d healing, want 1000 and 300", r.DamageTaken, r.HealingReceived)
+	}
+	if got, want := r.Overkill(), int64(200); got != want {
+		t.Errorf("death 0: overkill = %d, want %d", got, want)
+	}
+
+	r = recaps[1]
+	if r.Unit.ID != healer.ID || len(r.Events) != 1 || r.KillingBlow != nil {
+		t.Errorf("death 1 = %s with %d events and killing blow %#v, want %s with 1 event and none", r.Unit.Name, len(r.Events), r.KillingBlow, healer.Name)
+	}
+	if r.DamageTaken != 0 || r.HealingReceived != 0 || r.Overkill() != 0 {
+		t.Errorf("death 1: took %d damage and %d healing with %d overkill, want none", r.DamageTaken, r.HealingReceived, r.Overkill())
+	}
+
+	r = recaps[2]
+	if r.Unit.ID != tank.ID || r.KillingBlow == nil {
+		t.Fatalf("death 2 = %s with killing blow %#v, want %s", r.Unit.Name, r.KillingBlow, tank.Name)
+	}
+	if got, want := r.Overkill(), int64(0); got != want {
+		t.Errorf("death 2: overkill = %d, want %d", got, want)
+	}
+}
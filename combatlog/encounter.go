@@ -0,0 +1,164 @@
+package combatlog
+
+import (
+	"time"
+)
+
+// IdleGap is the length of time, in nanoseconds, without any damage after
+// which a heuristic encounter is considered to be over.
+const IdleGap = 30e9
+
+// An Encounter is a single pull, from the first event to the last.
+type Encounter struct {
+	// These are only available when the log has ENCOUNTER_START events.
+	ID         int64
+	Difficulty int64
+	GroupSize  int64
+
+	Name       string
+	Start, End time.Time
+	Kill       bool
+
+	// Events is the slice of the log covering this encounter.
+	Events CombatLog
+}
+
+// Duration returns the length of the encounter in nanoseconds.
+func (e Encounter) Duration() int64 {
+	return e.End.Nanoseconds() - e.Start.Nanoseconds()
+}
+
+// Encounters splits the log into boss encounters.  If the log contains
+// ENCOUNTER_START events, they (and their matching ENCOUNTER_END events) are
+// used to delimit the encounters.  Otherwise, the log is split heuristically
+// using SegmentByIdle.
+func (cl CombatLog) Encounters() []Encounter {
+	for _, e := range cl {
+		if _, ok := e.Data.(EncounterStart); ok {
+			return cl.segmentByEvents()
+		}
+	}
+	return cl.SegmentByIdle(IdleGap)
+}
+
+// segmentByEvents splits the log at ENCOUNTER_START and ENCOUNTER_END.  An
+// encounter which never ends (because logging stopped, for instance) ends at
+// the last event before the next encounter or the end of the log and is not
+// counted as a kill.
+func (cl CombatLog) segmentByEvents() (encounters []Encounter) {
+	var cur *Encounter
+	startIdx := 0
+
+	finish := func(endIdx int) {
+		cur.Events = cl[startIdx:endIdx]
+		cur.End = cl[endIdx-1].Time
+		encounters = append(encounters, *cur)
+		cur = nil
+	}
+
+	for i, e := range cl {
+		switch data := e.Data.(type) {
+		case EncounterStart:
+			if cur != nil {
+				finish(i)
+			}
+			cur = &Encounter{
+				ID:         data.EncounterID,
+				Name:       data.EncounterName,
+				Difficulty: data.DifficultyID,
+				GroupSize:  data.GroupSize,
+				Start:      e.Time,
+			}
+			startIdx = i
+		case EncounterEnd:
+			if cur == nil || cur.ID != data.EncounterID {
+				continue
+			}
+			cur.Kill = data.Success
+			finish(i + 1)
+		}
+	}
+	if cur != nil {
+		finish(len(cl))
+	}
+	return encounters
+}
+
+// SegmentByIdle splits the log into periods of combat separated by at least
+// gap nanoseconds without any damage being done.  Events outside of combat
+// are not included in any segment.
+//
+// Since older logs do not say who the boss was, the hostile unit which took
+// the most damage during the segment is assumed to be the boss; the segment
+// is named after it and is considered a kill if it died.
+func (cl CombatLog) SegmentByIdle(gap int64) (encounters []Encounter) {
+	first, last := -1, -1
+	var lastNS int64
+
+	// flush ends the current segment, including any trailing events (such
+	// as the boss dying) up to limit which happen before the gap expires.
+	flush := func(limit int) {
+		end := last + 1
+		for end < limit && cl[end].Time.Nanoseconds()-lastNS < gap {
+			end++
+		}
+		encounters = append(encounters, cl[first:end].idleSegment())
+		first = -1
+	}
+
+	for i, e := range cl {
+		if _, ok := e.Data.(damaged); !ok {
+			continue
+		}
+		ns := e.Time.Nanoseconds()
+		if first >= 0 && ns-lastNS >= gap {
+			flush(i)
+		}
+		if first < 0 {
+			first = i
+		}
+		last, lastNS = i, ns
+	}
+	if first >= 0 {
+		flush(len(cl))
+	}
+	return encounters
+}
+
+// idleSegment builds an Encounter for a segment found by SegmentByIdle.
+func (cl CombatLog) idleSegment() Encounter {
+	enc := Encounter{
+		Start:  cl[0].Time,
+		Events: cl,
+	}
+
+	taken := map[GUID]int64{}
+	var boss Unit
+	for _, e := range cl {
+		dmg, ok := e.Data.(damaged)
+		if !ok {
+			continue
+		}
+		p, ok := e.Data.(participants)
+		if !ok {
+			continue
+		}
+		enc.End = e.Time
+		dest := p.GetDest()
+		if !dest.Flags.IsHostile() {
+			continue
+		}
+		taken[dest.ID] += dmg.GetDamage().Amount
+		if taken[dest.ID] > taken[boss.ID] {
+			boss = dest
+		}
+	}
+	enc.Name = boss.Name
+
+	for _, e := range cl {
+		if died, ok := e.Data.(UnitDied); ok && len(boss.ID) > 0 && died.Dest.ID == boss.ID {
+			enc.Kill = true
+		}
+	}
+	return enc
+}
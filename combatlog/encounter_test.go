@@ -0,0 +1,145 @@
+package combatlog
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	testRaider = Unit{ID: "Player-1-00000001", Name: "Raider", Flags: UnitRaid}
+	testBoss   = Unit{ID: "Creature-0-1-1-1-100-1", Name: "Boss", Flags: UnitHostile}
+	testAdd    = Unit{ID: "Creature-0-1-1-1-200-2", Name: "Add", Flags: UnitHostile}
+)
+
+func at(min, sec int) time.Time {
+	return time.Time{Year: 2011, Month: 9, Day: 25, Minute: min, Second: sec}
+}
+
+func hit(t time.Time, src, dst Unit, amount int64) Event {
+	return Event{
+		Time: t,
+		Name: "SWING_DAMAGE",
+		Data: SwingDamage{
+			Common: Common{Source: src, Dest: dst},
+			Damage: Damage{Amount: amount},
+		},
+	}
+}
+
+func died(t time.Time, dst Unit) Event {
+	return Event{Time: t, Name: "UNIT_DIED", Data: UnitDied{Common{Dest: dst}}}
+}
+
+func TestEncountersByEvents(t *testing.T) {
+	cl := CombatLog{
+		hit(at(0, 0), testRaider, testAdd, 10),
+		{Time: at(1, 0), Name: "ENCOUNTER_START", Data: EncounterStart{
+			EncounterID: 1, EncounterName: "Boss", DifficultyID: 16, GroupSize: 20,
+		}},
+		hit(at(1, 1), testRaider, testBoss, 100),
+		{Time: at(2, 0), Name: "ENCOUNTER_END", Data: EncounterEnd{
+			EncounterID: 1, EncounterName: "Boss", DifficultyID: 16, GroupSize: 20,
+		}},
+		{Time: at(3, 0), Name: "ENCOUNTER_START", Data: EncounterStart{
+			EncounterID: 1, EncounterName: "Boss", DifficultyID: 16, GroupSize: 20,
+		}},
+		hit(at(3, 1), testRaider, testBoss, 100),
+		{Time: at(4, 30), Name: "ENCOUNTER_END", Data: EncounterEnd{
+			EncounterID: 1, EncounterName: "Boss", DifficultyID: 16, GroupSize: 20,
+			Success: true,
+		}},
+		hit(at(5, 0), testRaider, testAdd, 10),
+	}
+
+	encs := cl.Encounters()
+	if got, want := len(encs), 2; got != want {
+		t.Fatalf("got %d encounters, want %d", got, want)
+	}
+	for i, want := range []struct {
+		Kill     bool
+		Duration int64
+		Events   int
+	}{
+		{false, 60e9, 3},
+		{true, 90e9, 3},
+	} {
+		enc := encs[i]
+		if enc.Name != "Boss" || enc.Difficulty != 16 || enc.GroupSize != 20 {
+			t.Errorf("%d. got %q (%d/%d), want %q (16/20)", i, enc.Name, enc.Difficulty, enc.GroupSize, "Boss")
+		}
+		if enc.Kill != want.Kill {
+			t.Errorf("%d. kill = %v, want %v", i, enc.Kill, want.Kill)
+		}
+		if got := enc.Duration(); got != want.Duration {
+			t.Errorf("%d. duration = %d, want %d", i, got, want.Duration)
+		}
+		if got := len(enc.Events); got != want.Events {
+			t.Errorf("%d. got %d events, want %d", i, got, want.Events)
+		}
+	}
+}
+
+func TestSegmentByIdle(t *testing.T) {
+	cl := CombatLog{
+		// Wipe
+		hit(at(0, 0), testRaider, testBoss, 100),
+		hit(at(0, 10), testRaider, testAdd, 50),
+		hit(at(0, 20), testBoss, testRaider, 500),
+		died(at(0, 21), testRaider),
+
+		// Kill
+		hit(at(5, 0), testRaider, testAdd, 50),
+		hit(at(5, 10), testRaider, testBoss, 100),
+		hit(at(5, 20), testRaider, testBoss, 100),
+		died(at(5, 21), testBoss),
+	}
+
+	encs := cl.SegmentByIdle(IdleGap)
+	if got, want := len(encs), 2; got != want {
+		t.Fatalf("got %d segments, want %d", got, want)
+	}
+	for i, want := range []struct {
+		Kill     bool
+		Duration int64
+		Events   int
+	}{
+		{false, 20e9, 4},
+		{true, 20e9, 4},
+	} {
+		enc := encs[i]
+		if enc.Name != "Boss" {
+			t.Errorf("%d. name = %q, want %q", i, enc.Name, "Boss")
+		}
+		if enc.Kill != want.Kill {
+			t.Errorf("%d. kill = %v, want %v", i, enc.Kill, want.Kill)
+		}
+		if got := enc.Duration(); got != want.Duration {
+			t.Errorf("%d. duration = %d, want %d", i, got, want.Duration)
+		}
+		if got := len(enc.Events); got != want.Events {
+			t.Errorf("%d. got %d events, want %d", i, got, want.Events)
+		}
+	}
+}
+
+// A damageOnly event has an amount but no units, as a custom event type
+// might.
+type damageOnly struct {
+	Damage
+}
+
+func TestSegmentByIdleNoUnits(t *testing.T) {
+	cl := CombatLog{
+		hit(at(0, 0), testRaider, testBoss, 100),
+		{Time: at(0, 5), Name: "CUSTOM_DAMAGE", Data: damageOnly{Damage{Amount: 1000}}},
+		hit(at(0, 10), testRaider, testAdd, 50),
+	}
+
+	encs := cl.SegmentByIdle(IdleGap)
+	if got, want := len(encs), 1; got != want {
+		t.Fatalf("got %d segments, want %d", got, want)
+	}
+	if got, want := encs[0].Name, "Boss"; got != want {
+		t.Errorf("name = %q, want %q", got, want)
+	}
+}
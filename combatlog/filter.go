@@ -0,0 +1,79 @@
+package combatlog
+
+import (
+	"time"
+)
+
+// A Filter selects which lines a Reader decodes.  It is applied before the
+// fields of each line are decoded, using only the timestamp, the event name
+// and the unit GUIDs, so skipping lines is much cheaper than decoding them.
+// A nil field in the Filter matches everything.
+type Filter struct {
+	// Names holds the names of the events to decode.
+	Names map[string]bool
+
+	// Units, if set, is called with the source and destination GUIDs of
+	// each event which has them; the event is decoded if it returns true.
+	// Events without units (such as ENCOUNTER_START) are not filtered, and
+	// nor are events of unknown types (RawEvent), whose units may not be
+	// where Units would look for them.
+	// When Reader.Workers is greater than one, Units is called from
+	// several goroutines at once, so it must be safe for concurrent use.
+	Units func(source, dest GUID) bool
+
+	// Events before After or after Before are skipped.  A Reader stops at
+	// the first event after Before, since the log is in time order (unless
+	// it is an archive of several logs).
+	After, Before *time.Time
+}
+
+// NewFilter returns a Filter which decodes only the named events.
+func NewFilter(names ...string) *Filter {
+	f := &Filter{Names: map[string]bool{}}
+	for _, name := range names {
+		f.Names[name] = true
+	}
+	return f
+}
+
+// matchTime returns true if an event at t should be decoded.
+func (f *Filter) matchTime(t time.Time) bool {
+	ns := t.Nanoseconds()
+	if f.After != nil && ns < f.After.Nanoseconds() {
+		return false
+	}
+	if f.Before != nil && ns > f.Before.Nanoseconds() {
+		return false
+	}
+	return true
+}
+
+// matchName returns true if an event called name should be decoded.
+func (f *Filter) matchName(name string) bool {
+	return f.Names == nil || f.Names[name]
+}
+
+// matchUnits returns true if the event whose fields are in csv should be
+// decoded.  The caller must ensure that the event begins with a Common.
+func (f *Filter) matchUnits(csv string) bool {
+	if f.Units == nil {
+		return true
+	}
+
+	// Common is source GUID, name, flags, raid flags, then dest GUID, ...
+	// They are copied in case Units keeps them, since the line may be in a
+	// shared buffer (see Reader.Scan).
+	var ids [2]GUID
+	start := 0
+	for i := 0; i < 5 && start <= len(csv); i++ {
+		comma := nextField(csv[start:])
+		switch i {
+		case 0:
+			ids[0] = GUID(copyString(csv[start:][:comma]))
+		case 4:
+			ids[1] = GUID(copyString(csv[start:][:comma]))
+		}
+		start += comma + 1
+	}
+	return f.Units(ids[0], ids[1])
+}
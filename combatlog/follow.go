@@ -0,0 +1,372 @@
+package combatlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PollInterval is how often (in nanoseconds) a Follower checks its log for
+// new lines once it has caught up.
+const PollInterval = 100e6
+
+// A Follower reads a log while the client is still writing it, like tail -F,
+// so that events can be processed during a fight.  Typical usage is:
+//
+//	f := combatlog.NewFollower("Logs")
+//	for e := range f.Start() {
+//		...
+//	}
+//
+// where another goroutine calls f.Stop when it is done.
+//
+// Only events written after Start are read, unless FromStart is set.  If the
+// path is a directory, the Follower reads the most recently modified log in
+// it matching ArchivePattern and switches to a newer one when the client
+// starts it.  If the log is truncated or replaced, it is read again from the
+// start.  Lines are only decoded once the client has finished writing them.
+type Follower struct {
+	// Filter and OnError are used as in Reader.  Lines which cannot be
+	// parsed are always skipped rather than stopping the Follower.
+	Filter  *Filter
+	OnError func(*ParseError)
+
+	// Buffer is the capacity of the channel returned by Start.
+	Buffer int
+
+	// FromStart causes the log to be read from the beginning rather than
+	// from the end when the Follower starts.  Line numbers in errors are
+	// only counted from where the Follower started.
+	FromStart bool
+
+	path string
+	quit chan bool
+	stop sync.Once
+	done chan bool
+	err  os.Error
+
+	// The log being read
+	name string
+	file *os.File
+	info *os.FileInfo
+	r    *Reader
+	buf  []byte // unread data, starting with the current partial line
+	skip bool   // whether the rest of the current line is being skipped
+}
+
+// NewFollower returns a Follower for the log at path, which may be a file or
+// the directory the client writes its logs to.
+func NewFollower(path string) *Follower {
+	return &Follower{
+		Buffer: 1024,
+		path:   path,
+	}
+}
+
+// Start starts following the log.  The log is opened before Start returns,
+// so every event written after that is read.  Events are sent on the
+// returned channel, which is closed when the Follower is stopped or an error
+// occurs (including failing to open the log).
+func (f *Follower) Start() <-chan Event {
+	events := make(chan Event, f.Buffer)
+	f.quit = make(chan bool)
+	f.done = make(chan bool)
+	if f.err = f.open(!f.FromStart); f.err != nil {
+		close(events)
+		close(f.done)
+		return events
+	}
+	go f.run(events)
+	return events
+}
+
+// Stop stops the Follower, closes its log and waits for its channel to be
+// closed.  It returns the error which stopped the Follower, if any.  It may
+// be called more than once, and after the Follower has stopped by itself.
+func (f *Follower) Stop() os.Error {
+	f.stop.Do(func() {
+		close(f.quit)
+	})
+	<-f.done
+	return f.err
+}
+
+// Err returns the error which stopped the Follower, if any.  It is only valid
+// after the channel returned by Start has been closed.
+func (f *Follower) Err() os.Error {
+	return f.err
+}
+
+func (f *Follower) run(events chan<- Event) {
+	defer close(f.done)
+	defer close(events)
+	defer func() {
+		if f.file != nil {
+			f.file.Close()
+		}
+	}()
+
+	chunk := make([]byte, 64*1024)
+	for {
+		if f.file == nil {
+			if f.err = f.open(false); f.err != nil {
+				return
+			}
+		}
+
+		n, err := f.file.Read(chunk)
+		if n > 0 {
+			f.buf = append(f.buf, chunk[:n]...)
+			if !f.lines(events) {
+				return
+			}
+			continue
+		}
+		if err != nil && err != os.EOF {
+			f.err = err
+			return
+		}
+
+		// Caught up; wait for the client to write more
+		select {
+		case <-f.quit:
+			return
+		case <-time.After(PollInterval):
+		}
+		if f.err = f.check(events); f.err != nil {
+			return
+		}
+	}
+}
+
+// open opens the log to follow and starts reading it from the beginning, or
+// from the end if atEnd is set.
+func (f *Follower) open(atEnd bool) os.Error {
+	name := f.path
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDirectory() {
+		if name, err = newestLog(f.path); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	if fi, err = file.Stat(); err != nil {
+		file.Close()
+		return err
+	}
+
+	f.name, f.file, f.info = name, file, fi
+	f.buf, f.skip = f.buf[:0], false
+	f.r = &Reader{
+		Lenient: true,
+		OnError: f.OnError,
+		Filter:  f.Filter,
+		strings: newInterner(),
+	}
+	f.r.setStart(name, fi)
+	if atEnd {
+		if err := f.seekEnd(); err != nil {
+			f.file.Close()
+			f.file = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// seekEnd moves to the end of the log.  The header in effect there is found
+// by searching backwards, since it determines the layout of the lines.
+func (f *Follower) seekEnd() os.Error {
+	end, err := f.file.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+	f.r.offset = end
+	if end == 0 {
+		return nil
+	}
+
+	// Skip the rest of a line the client is part way through writing
+	last := make([]byte, 1)
+	if _, err := f.file.ReadAt(last, end-1); err != nil {
+		return err
+	}
+	f.skip = last[0] != '\n'
+
+	if v, ok, err := lastLogVersion(f.file, end); err != nil {
+		return err
+	} else if ok {
+		f.r.version = v
+	}
+	return nil
+}
+
+// lastLogVersion returns the last COMBAT_LOG_VERSION header in the first
+// end bytes of file.
+func lastLogVersion(file *os.File, end int64) (v LogVersion, ok bool, err os.Error) {
+	const chunk = 1024 * 1024
+	marker := []byte("  " + LogVersionEvent + ",")
+
+	// Each read overlaps the previous one by a line, so that a header
+	// straddling two chunks is seen whole.
+	buf := make([]byte, chunk+ReadBufferSize)
+	for hi := end; hi > 0; {
+		lo := hi - chunk
+		if lo < 0 {
+			lo = 0
+		}
+		n := hi - lo + ReadBufferSize
+		if lo+n > end {
+			n = end - lo
+		}
+		data := buf[:n]
+		if _, err := file.ReadAt(data, lo); err != nil && err != os.EOF {
+			return v, false, err
+		}
+		if i := bytes.LastIndex(data, marker); i >= 0 {
+			start := bytes.LastIndex(data[:i], []byte("\n")) + 1
+			stop := bytes.IndexByte(data[i:], '\n')
+			if stop < 0 {
+				stop = len(data) - i
+			}
+			line := string(data[start : i+stop])
+			if _, _, csv, lok := splitLine(strings.TrimRight(line, "\r")); lok {
+				if v, err := parseLogVersion(csv); err == nil {
+					return v, true, nil
+				}
+			}
+		}
+		hi = lo
+	}
+	return v, false, nil
+}
+
+// check looks for a new, replaced or truncated log after the Follower has
+// caught up with the current one.  If there is one, the rest of the current
+// log is flushed and the Follower reopens.
+func (f *Follower) check(events chan<- Event) os.Error {
+	reopen := false
+	if f.name != f.path {
+		newest, err := newestLog(f.path)
+		if err != nil {
+			return err
+		}
+		reopen = newest != f.name
+	}
+
+	fi, err := os.Stat(f.name)
+	switch {
+	case err != nil:
+		// The log may be being replaced; try again next time
+		return nil
+	case fi.Ino != f.info.Ino || fi.Dev != f.info.Dev:
+		reopen = true
+	case fi.Size < f.r.offset+int64(len(f.buf)):
+		reopen = true
+	}
+	if !reopen {
+		return nil
+	}
+
+	// The client won't finish the last line of the old log
+	if len(f.buf) > 0 && !f.skip {
+		f.buf = append(f.buf, '\n')
+		f.lines(events)
+	}
+	f.file.Close()
+	f.file = nil
+	return nil
+}
+
+// lines decodes the complete lines in f.buf and sends their events.  It
+// returns false if the Follower was stopped.
+func (f *Follower) lines(events chan<- Event) bool {
+	start := 0
+	for {
+		nl := bytes.IndexByte(f.buf[start:], '\n')
+		if nl < 0 {
+			break
+		}
+		line := f.buf[start : start+nl+1]
+		start += nl + 1
+
+		if f.skip {
+			f.skip = false
+			f.r.offset += int64(len(line))
+			continue
+		}
+		ok := f.r.feed(string(line))
+		f.r.errors = f.r.errors[:0] // only reported to OnError
+		if !ok {
+			continue
+		}
+		select {
+		case events <- f.r.Event():
+		case <-f.quit:
+			return false
+		}
+	}
+
+	// Keep the partial line until the rest of it is written
+	n := copy(f.buf, f.buf[start:])
+	f.buf = f.buf[:n]
+	if n > ReadBufferSize {
+		f.r.line++
+		f.r.fail(&ParseError{
+			Line:   f.r.line,
+			Offset: f.r.offset,
+			Text:   string(f.buf),
+			Field:  -1,
+			Err:    os.NewError("line too long"),
+		})
+		f.r.offset += int64(n)
+		f.buf, f.skip = f.buf[:0], true
+	}
+	return true
+}
+
+// feed decodes a line read by something other than the Reader itself.  It
+// returns true if the line is the next event.
+func (r *Reader) feed(line string) bool {
+	r.line++
+	l := rawLine{
+		text:   strings.TrimRight(line, "\r\n"),
+		line:   r.line,
+		offset: r.offset,
+	}
+	r.offset += int64(len(line))
+	d := decodeLine(l, r.version, r.Filter, r.strings)
+	return r.accept(&d)
+}
+
+// newestLog returns the most recently modified log in dir.
+func newestLog(dir string) (string, os.Error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var newest *os.FileInfo
+	for _, fi := range infos {
+		if ok, _ := filepath.Match(ArchivePattern, fi.Name); !ok || !fi.IsRegular() {
+			continue
+		}
+		if newest == nil || fi.Mtime_ns > newest.Mtime_ns {
+			newest = fi
+		}
+	}
+	if newest == nil {
+		return "", os.NewError("combatlog: no logs matching " + ArchivePattern + " in " + dir)
+	}
+	return filepath.Join(dir, newest.Name), nil
+}
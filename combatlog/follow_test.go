@@ -0,0 +1,122 @@
+package combatlog
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// followLog creates a temporary log containing lines and returns it with
+// functions to append to it and to wait for the next event from events.
+func followLog(t *testing.T, lines string, events *<-chan Event) (*os.File, func(string), func(string) Event) {
+	file, err := ioutil.TempFile("", "combatlog")
+	if err != nil {
+		t.Fatalf("tempfile: %s", err)
+	}
+	write := func(s string) {
+		if _, err := file.WriteString(s); err != nil {
+			t.Fatalf("write: %s", err)
+		}
+	}
+	next := func(desc string) Event {
+		select {
+		case e, ok := <-*events:
+			if !ok {
+				t.Fatalf("%s: follower stopped", desc)
+			}
+			return e
+		case <-time.After(5e9):
+			t.Fatalf("%s: timed out", desc)
+		}
+		panic("unreachable")
+	}
+	write(lines)
+	return file, write, next
+}
+
+func TestFollower(t *testing.T) {
+	// The log already has a header and an event, and the client is part way
+	// through writing another.
+	old := decodeTests[2].Lines[1:]
+	line := strings.Split(old, "\n")[1] + "\n"
+	half := len(line) / 2
+
+	var events <-chan Event
+	file, write, next := followLog(t, old+line[:half], &events)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	f := NewFollower(file.Name())
+	events = f.Start()
+
+	// Only the lines written after Start are read, with the layout given by
+	// the header before them.
+	write(line[half:])
+	write(strings.Replace(line, "20:30:01.000", "20:30:02.000", 1))
+	e := next("append")
+	if d, ok := e.Data.(SpellDamage); !ok || e.Time.Second != 2 || d.Advanced.CurrentHP != 950000 {
+		t.Errorf("append: got %s at %d: %#v", e.Name, e.Time.Second, e.Data)
+	}
+
+	// Start the log again.  It is shorter than before, so the truncation is
+	// seen before the new lines are read.
+	if err := file.Truncate(0); err != nil {
+		t.Fatalf("truncate: %s", err)
+	}
+	file.Seek(0, 0)
+	write(decodeTests[0].Lines[1:])
+	for i, want := range decodeTests[0].Events {
+		if got := next("truncate"); got.Name != want.Name || got.Time.Second != want.Time.Second {
+			t.Errorf("truncate: event %d = %s at %d, want %s at %d", i, got.Name, got.Time.Second, want.Name, want.Time.Second)
+		}
+	}
+
+	if err := f.Stop(); err != nil {
+		t.Errorf("stop: %s", err)
+	}
+	if _, ok := <-events; ok {
+		t.Errorf("events not closed after Stop")
+	}
+	if err := f.Stop(); err != nil {
+		t.Errorf("second stop: %s", err)
+	}
+}
+
+func TestFollowerFromStart(t *testing.T) {
+	lines := decodeTests[0].Lines[1:]
+	half := len(lines) / 2
+
+	var events <-chan Event
+	file, write, next := followLog(t, lines[:half], &events)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	f := NewFollower(file.Name())
+	f.FromStart = true
+	events = f.Start()
+
+	write(lines[half:])
+	for i, want := range decodeTests[0].Events {
+		if got := next("from start"); got.Name != want.Name || got.Time.Second != want.Time.Second {
+			t.Errorf("event %d = %s at %d, want %s at %d", i, got.Name, got.Time.Second, want.Name, want.Time.Second)
+		}
+	}
+	if err := f.Stop(); err != nil {
+		t.Errorf("stop: %s", err)
+	}
+}
+
+func TestFollowerMissing(t *testing.T) {
+	f := NewFollower(os.TempDir() + "/combatlog-missing/WoWCombatLog.txt")
+	if _, ok := <-f.Start(); ok {
+		t.Errorf("got an event from a missing log")
+	}
+	if err := f.Err(); err == nil {
+		t.Errorf("no error for a missing log")
+	}
+	if err := f.Stop(); err == nil {
+		t.Errorf("Stop: no error for a missing log")
+	}
+}
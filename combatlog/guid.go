@@ -0,0 +1,180 @@
+package combatlog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A GUID is the globally unique identifier of a unit as it appears in the
+// log.  Older clients write a hex number (0xF130966900007981) and newer
+// clients write a hyphenated string (Player-1084-0A1B2C3D).
+type GUID string
+
+// IsZero returns true if g is the empty GUID written for missing units.
+func (g GUID) IsZero() bool {
+	s := string(g)
+	if len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X") {
+		s = s[2:]
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// GUIDKind is the kind of unit identified by a GUID.
+type GUIDKind int
+
+const (
+	GUIDUnknown GUIDKind = iota
+	GUIDPlayer
+	GUIDCreature
+	GUIDPet
+	GUIDVehicle
+	GUIDGameObject
+	GUIDOther // a kind not listed above, such as an Item
+)
+
+var guidKindNames = [...]string{
+	"Unknown", "Player", "Creature", "Pet", "Vehicle", "GameObject", "Other",
+}
+
+func (k GUIDKind) String() string {
+	if k >= 0 && int(k) < len(guidKindNames) {
+		return guidKindNames[k]
+	}
+	return "Unknown"
+}
+
+// GUIDInfo holds the parts of a GUID.  Which parts are available depends on
+// the kind of unit and the version of the client which wrote the log.
+type GUIDInfo struct {
+	Kind     GUIDKind
+	ServerID int64 // the realm (players) or server (creatures)
+
+	// These are set for creatures, pets, vehicles and game objects
+	InstanceID int64
+	ZoneUID    int64
+	NPCID      int64 // the same for every instance of an NPC
+
+	// SpawnUID distinguishes units of the same NPCID, or for players it is
+	// the character's unique ID on their realm.
+	SpawnUID string
+}
+
+// Legacy GUIDs store the kind in the low three bits of their third hex digit
+var legacyKinds = map[byte]GUIDKind{
+	0: GUIDPlayer,
+	1: GUIDGameObject,
+	3: GUIDCreature,
+	4: GUIDPet,
+	5: GUIDVehicle,
+}
+
+var guidKinds = map[string]GUIDKind{
+	"Player":     GUIDPlayer,
+	"Creature":   GUIDCreature,
+	"Pet":        GUIDPet,
+	"Vehicle":    GUIDVehicle,
+	"GameObject": GUIDGameObject,
+}
+
+// Info parses g into its parts.  Both the hex GUIDs written by older clients
+// and the hyphenated GUIDs written by newer clients are understood.  If g
+// cannot be parsed, the zero GUIDInfo (of kind GUIDUnknown) is returned.
+func (g GUID) Info() (info GUIDInfo, err os.Error) {
+	s := string(g)
+	if g.IsZero() {
+		return info, nil
+	}
+
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		id, err := strconv.Btoui64(s, 0)
+		if err != nil {
+			return GUIDInfo{}, fmt.Errorf("combatlog: bad GUID %q: %s", s, err)
+		}
+		kind, ok := legacyKinds[byte(id>>52)&0x7]
+		if !ok {
+			kind = GUIDOther
+		}
+		info.Kind = kind
+		if kind == GUIDPlayer {
+			info.SpawnUID = fmt.Sprintf("%012X", id&0xFFFFFFFFFFFF)
+		} else {
+			info.NPCID = int64(id>>32) & 0xFFFFF
+			info.SpawnUID = fmt.Sprintf("%08X", id&0xFFFFFFFF)
+		}
+		return info, nil
+	}
+
+	parts := strings.Split(s, "-")
+	kind, ok := guidKinds[parts[0]]
+	if !ok {
+		kind = GUIDOther
+	}
+
+	atoi := func(i int) int64 {
+		if err != nil || i >= len(parts) {
+			return 0
+		}
+		var n int64
+		n, err = strconv.Atoi64(parts[i])
+		return n
+	}
+
+	switch kind {
+	case GUIDPlayer:
+		// Player-[server]-[uid]
+		if len(parts) != 3 {
+			return GUIDInfo{}, fmt.Errorf("combatlog: bad GUID %q: want 3 parts", s)
+		}
+		info.ServerID = atoi(1)
+		info.SpawnUID = parts[2]
+	case GUIDCreature, GUIDPet, GUIDVehicle, GUIDGameObject:
+		// Kind-0-[server]-[instance]-[zone]-[npc]-[spawn]
+		if len(parts) != 7 {
+			return GUIDInfo{}, fmt.Errorf("combatlog: bad GUID %q: want 7 parts", s)
+		}
+		info.ServerID = atoi(2)
+		info.InstanceID = atoi(3)
+		info.ZoneUID = atoi(4)
+		info.NPCID = atoi(5)
+		info.SpawnUID = parts[6]
+	}
+	if err != nil {
+		return GUIDInfo{}, fmt.Errorf("combatlog: bad GUID %q: %s", s, err)
+	}
+	info.Kind = kind
+	return info, nil
+}
+
+// Kind returns the kind of unit identified by g, or GUIDUnknown if g cannot
+// be parsed.
+func (g GUID) Kind() GUIDKind {
+	info, _ := g.Info()
+	return info.Kind
+}
+
+// NPCID returns the ID shared by every instance of the NPC identified by g,
+// or 0 if g does not identify an NPC.
+func (g GUID) NPCID() int64 {
+	info, _ := g.Info()
+	return info.NPCID
+}
+
+// ServerID returns the ID of the realm or server of g, or 0 if unknown.
+func (g GUID) ServerID() int64 {
+	info, _ := g.Info()
+	return info.ServerID
+}
+
+// SpawnUID returns the part of g which distinguishes it from other units
+// with the same NPCID (or, for players, on the same realm).
+func (g GUID) SpawnUID() string {
+	info, _ := g.Info()
+	return info.SpawnUID
+}
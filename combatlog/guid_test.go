@@ -0,0 +1,49 @@
+package combatlog
+
+import (
+	"reflect"
+	"testing"
+)
+
+var guidTests = []struct {
+	GUID GUID
+	Info GUIDInfo
+}{
+	{"0x0000000000000000", GUIDInfo{}},
+	{"0000000000000000", GUIDInfo{}},
+	{"0xF130966900007981", GUIDInfo{Kind: GUIDCreature, NPCID: 0x9669, SpawnUID: "00007981"}},
+	{"0xF15079A30069A7D9", GUIDInfo{Kind: GUIDVehicle, NPCID: 0x79A3, SpawnUID: "0069A7D9"}},
+	{"0x0500000003E3F2A1", GUIDInfo{Kind: GUIDPlayer, SpawnUID: "000003E3F2A1"}},
+	{"Player-1084-0A1B2C3D", GUIDInfo{Kind: GUIDPlayer, ServerID: 1084, SpawnUID: "0A1B2C3D"}},
+	{"Creature-0-3137-1530-1234-103685-00004F2B6A", GUIDInfo{
+		Kind: GUIDCreature, ServerID: 3137, InstanceID: 1530, ZoneUID: 1234,
+		NPCID: 103685, SpawnUID: "00004F2B6A",
+	}},
+	{"Pet-0-3137-1530-1234-165189-01023A4B5C", GUIDInfo{
+		Kind: GUIDPet, ServerID: 3137, InstanceID: 1530, ZoneUID: 1234,
+		NPCID: 165189, SpawnUID: "01023A4B5C",
+	}},
+	{"Item-1084-0-4000000ABCDEF", GUIDInfo{Kind: GUIDOther}},
+}
+
+func TestGUIDInfo(t *testing.T) {
+	for _, test := range guidTests {
+		info, err := test.GUID.Info()
+		if err != nil {
+			t.Errorf("%s: %s", test.GUID, err)
+			continue
+		}
+		if !reflect.DeepEqual(info, test.Info) {
+			t.Errorf("%s: info = %+v, want %+v", test.GUID, info, test.Info)
+		}
+	}
+
+	for _, bad := range []GUID{"Player-1084", "Creature-0-x-1-2-3-4", "0xnothex"} {
+		if _, err := bad.Info(); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+		if kind := bad.Kind(); kind != GUIDUnknown {
+			t.Errorf("%s: kind = %s, want %s", bad, kind, GUIDUnknown)
+		}
+	}
+}
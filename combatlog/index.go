@@ -0,0 +1,235 @@
+package combatlog
+
+import (
+	"bufio"
+	"gob"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// IndexSuffix is appended to the name of a log to get the name of its
+	// index.
+	IndexSuffix = ".index"
+
+	// IndexInterval is the default time (in nanoseconds) between entries in
+	// an index.
+	IndexInterval = 60e9
+)
+
+// An IndexEntry records where a line of the log starts and the state needed
+// to start reading from it.
+type IndexEntry struct {
+	Time    time.Time  // of the event on the line
+	Offset  int64      // of the start of the line
+	Line    int        // line number, starting at 1
+	Version LogVersion // the header in effect
+}
+
+// An IndexedEncounter is an IndexEntry for an ENCOUNTER_START line.
+type IndexedEncounter struct {
+	IndexEntry
+	EncounterStart
+}
+
+// An Index allows a Reader to start reading a log part of the way through.
+// Entries are recorded every Interval nanoseconds of the log and at the start
+// of every encounter.
+type Index struct {
+	Interval   int64
+	Entries    []IndexEntry // in log order
+	Encounters []IndexedEncounter
+}
+
+// BuildIndex reads the log in filename and builds an index for it, with
+// entries at most interval nanoseconds apart.  Lines which cannot be parsed
+// are skipped.
+func BuildIndex(filename string, interval int64) (*Index, os.Error) {
+	r, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if r.seeker == nil {
+		return nil, os.NewError("combatlog: " + filename + ": cannot index a compressed log")
+	}
+	r.Lenient = true
+
+	idx := &Index{Interval: interval}
+	var next int64
+	for r.Scan() {
+		r.errors = r.errors[:0] // the skipped lines aren't needed
+
+		e := IndexEntry{
+			Time:    r.Time(),
+			Offset:  r.scanned.offset,
+			Line:    r.scanned.line,
+			Version: r.version,
+		}
+		if ns := e.Time.Nanoseconds(); len(idx.Entries) == 0 || ns >= next {
+			idx.Entries = append(idx.Entries, e)
+			next = ns + interval
+		}
+		if r.Name() == "ENCOUNTER_START" {
+			enc := IndexedEncounter{IndexEntry: e}
+			if err := r.Decode(&enc.EncounterStart); err == nil {
+				idx.Encounters = append(idx.Encounters, enc)
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// LoadIndex returns the index for the log in filename with the given
+// interval.  If the index stored next to the log is out of date, a new one is
+// built and stored; failing to store it is not an error.
+func LoadIndex(filename string, interval int64) (*Index, os.Error) {
+	if idx, err := readIndex(filename); err == nil && idx.Interval == interval {
+		return idx, nil
+	}
+
+	// As in LoadFile, the key is taken before the log is read
+	key, err := logKey(filename)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := BuildIndex(filename, interval)
+	if err != nil {
+		return nil, err
+	}
+	idx.write(filename, key)
+	return idx, nil
+}
+
+// readIndex reads the index stored next to the log in filename.  It returns
+// ErrStaleCache if the log has changed since the index was written.
+func readIndex(filename string) (*Index, os.Error) {
+	file, err := os.Open(filename + IndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	want, err := logKey(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(bufio.NewReader(file))
+	var key cacheKey
+	if err := dec.Decode(&key); err != nil {
+		return nil, err
+	}
+	if !key.matches(want) {
+		return nil, ErrStaleCache
+	}
+	idx := new(Index)
+	if err := dec.Decode(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Write stores idx next to the log in filename, which it must index.
+func (idx *Index) Write(filename string) os.Error {
+	key, err := logKey(filename)
+	if err != nil {
+		return err
+	}
+	return idx.write(filename, key)
+}
+
+// write stores idx, which was built from filename when it had the given key.
+func (idx *Index) write(filename string, key cacheKey) (err os.Error) {
+	tmp := filename + IndexSuffix + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(key); err != nil {
+		return err
+	}
+	if err := enc.Encode(idx); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename+IndexSuffix)
+}
+
+// Find returns the last entry at or before t, or the first entry if t is
+// before the start of the log.  It returns false if the index is empty.
+func (idx *Index) Find(t time.Time) (IndexEntry, bool) {
+	if len(idx.Entries) == 0 {
+		return IndexEntry{}, false
+	}
+	ns := t.Nanoseconds()
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Time.Nanoseconds() > ns
+	})
+	if i > 0 {
+		i--
+	}
+	return idx.Entries[i], true
+}
+
+// SeekTime moves r, which must have been returned by Open for the log idx
+// was built from, so that Next returns the first event at or after t.
+func (r *Reader) SeekTime(idx *Index, t time.Time) os.Error {
+	e, ok := idx.Find(t)
+	if !ok {
+		return os.NewError("combatlog: empty index")
+	}
+	if err := r.seek(e); err != nil {
+		return err
+	}
+	r.seekTime = t.Nanoseconds()
+	return nil
+}
+
+// SeekEncounter moves r, which must have been returned by Open for the log
+// idx was built from, so that Next returns idx.Encounters[i].
+func (r *Reader) SeekEncounter(idx *Index, i int) os.Error {
+	if i < 0 || i >= len(idx.Encounters) {
+		return os.NewError("combatlog: encounter out of range")
+	}
+	return r.seek(idx.Encounters[i].IndexEntry)
+}
+
+// seek moves r to the line recorded in e.
+func (r *Reader) seek(e IndexEntry) os.Error {
+	if r.seeker == nil {
+		return os.NewError("combatlog: log cannot be seeked")
+	}
+	r.stopPipeline()
+	r.pipe = nil
+
+	if _, err := r.seeker.Seek(e.Offset, os.SEEK_SET); err != nil {
+		r.err = err
+		return err
+	}
+	r.lines, r.err = bufio.NewReaderSize(r.seeker, ReadBufferSize)
+	r.line, r.offset = e.Line-1, e.Offset
+	r.version = e.Version
+	r.event, r.seekTime, r.past = Event{}, 0, false
+
+	// Carry on inferring the year from the entry
+	r.years, r.lastMonth = e.Time.Year-r.Year, e.Time.Month
+	return r.err
+}
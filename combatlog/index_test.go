@@ -0,0 +1,103 @@
+package combatlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// indexLog returns a log with a header, a swing every 10 seconds from 20:00
+// to 20:05 and an encounter starting at 20:02:05.
+func indexLog() string {
+	const swing = `SWING_DAMAGE,0xF15096640000699C,"Argent Warhorse",0xa18,0x0,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0,155,155,-1,1,0,0,0,nil,nil,nil`
+	lines := "10/18 20:00:00.000  COMBAT_LOG_VERSION,20,ADVANCED_LOG_ENABLED,0,BUILD_VERSION,10.1.7,PROJECT_ID,1\n"
+	for sec := 0; sec < 300; sec += 10 {
+		lines += fmt.Sprintf("10/18 20:%02d:%02d.000  %s\n", sec/60, sec%60, swing)
+		if sec == 120 {
+			lines += `10/18 20:02:05.000  ENCOUNTER_START,2820,"Gnarlroot",16,20,2549` + "\n"
+		}
+		if sec == 200 {
+			// A truncated line, as left by a client crash
+			lines += "10/18 20:03:2\n"
+		}
+	}
+	return lines
+}
+
+func TestIndex(t *testing.T) {
+	name := tempLog(t, func(w io.Writer) os.Error {
+		_, err := io.WriteString(w, indexLog())
+		return err
+	})
+	defer os.Remove(name)
+	defer os.Remove(name + IndexSuffix)
+
+	r, err := Open(name)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer r.Close()
+	r.Lenient = true
+	cl, err := r.readAll()
+	if err != nil {
+		t.Fatalf("readAll: %s", err)
+	}
+
+	idx, err := LoadIndex(name, 60e9)
+	if err != nil {
+		t.Fatalf("LoadIndex: %s", err)
+	}
+	if got, want := len(idx.Entries), 5; got != want {
+		t.Errorf("got %d entries, want %d", got, want)
+	}
+	if got, want := len(idx.Encounters), 1; got != want {
+		t.Fatalf("got %d encounters, want %d", got, want)
+	}
+	if got, want := idx.Encounters[0].EncounterName, "Gnarlroot"; got != want {
+		t.Errorf("encounter = %q, want %q", got, want)
+	}
+
+	stored, err := readIndex(name)
+	if err != nil {
+		t.Fatalf("readIndex: %s", err)
+	}
+	if !reflect.DeepEqual(stored, idx) {
+		t.Errorf("stored index:\n got: %#v\nwant: %#v", stored, idx)
+	}
+	for i, e := range stored.Entries {
+		if got, want := e.Version.Build, "10.1.7"; got != want {
+			t.Errorf("entry %d: build = %q, want %q", i, got, want)
+		}
+	}
+
+	if err := r.SeekEncounter(idx, 0); err != nil {
+		t.Fatalf("SeekEncounter: %s", err)
+	}
+	if !r.Next() || r.Event().Name != "ENCOUNTER_START" {
+		t.Errorf("after SeekEncounter, got %s, want ENCOUNTER_START", r.Event().Name)
+	}
+	if got, want := r.Version().Build, "10.1.7"; got != want {
+		t.Errorf("after SeekEncounter, build = %q, want %q", got, want)
+	}
+
+	// Seek between entries, backwards, and between events
+	for _, i := range []int{20, 3, 0, 29} {
+		want := cl[i]
+		seek := want.Time
+		seek.Nanosecond = -1e6
+		if i == 0 {
+			seek.Hour--
+		}
+		if err := r.SeekTime(idx, seek); err != nil {
+			t.Fatalf("SeekTime: %s", err)
+		}
+		if !r.Next() {
+			t.Fatalf("SeekTime(%d): no event: %v", i, r.Err())
+		}
+		if got := r.Event(); !reflect.DeepEqual(got, want) {
+			t.Errorf("SeekTime(%d):\n got: %#v\nwant: %#v", i, got, want)
+		}
+	}
+}
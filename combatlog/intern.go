@@ -0,0 +1,69 @@
+package combatlog
+
+import (
+	"os"
+	"strconv"
+)
+
+// InternLimit is the number of distinct strings an interner will remember.
+// Logs only contain a few thousand distinct units and spells, so the limit
+// is only reached for pathological logs; strings after it are still copied
+// but not shared.
+const InternLimit = 1 << 16
+
+// An interner shares the backing memory of repeated string fields (unit
+// names, GUIDs, spell names, etc) between events, so that each distinct
+// value is only allocated once.  Fields which change from line to line, such
+// as the power of a unit, are not interned, since they would fill the table.
+// Strings it returns never refer to the memory of the string they were
+// looked up with, so they may be used after the line they came from has been
+// overwritten.
+//
+// An interner is not safe for concurrent use; each goroutine decoding lines
+// uses its own.
+type interner struct {
+	strings map[string]string // raw field => decoded value
+}
+
+func newInterner() *interner {
+	return &interner{
+		strings: make(map[string]string),
+	}
+}
+
+// intern returns the decoded value of the raw field fstr, unquoting it if
+// it is quoted.
+func (in *interner) intern(fstr string) (string, os.Error) {
+	if s, ok := in.strings[fstr]; ok {
+		return s, nil
+	}
+
+	key := copyString(fstr)
+	s, err := unquote(key)
+	if err != nil {
+		return "", err
+	}
+	if len(in.strings) < InternLimit {
+		in.strings[key] = s
+	}
+	return s, nil
+}
+
+// decodeString returns the decoded value of the raw field fstr like intern,
+// but without remembering it.
+func decodeString(fstr string) (string, os.Error) {
+	return unquote(copyString(fstr))
+}
+
+// unquote returns s without its quotes, if it is quoted.
+func unquote(s string) (string, os.Error) {
+	if len(s) > 0 && s[0] == '"' {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// copyString returns a copy of s which does not share its memory.
+func copyString(s string) string {
+	return string([]byte(s))
+}
@@ -0,0 +1,268 @@
+package combatlog
+
+import (
+	"sort"
+	"time"
+)
+
+// MeterTotals holds the amounts of damage and healing done by a single unit.
+type MeterTotals struct {
+	Unit Unit
+
+	Damage   int64 // includes overkill
+	Overkill int64
+	Absorbed int64 // damage which was absorbed by the target
+
+	Healing      int64 // includes overhealing
+	Overheal     int64
+	HealAbsorbed int64 // healing which was absorbed by the target
+}
+
+// EffectiveDamage returns the damage done excluding overkill.
+func (t *MeterTotals) EffectiveDamage() int64 {
+	return t.Damage - t.Overkill
+}
+
+// isZero reports whether t has no damage or healing.
+func (t *MeterTotals) isZero() bool {
+	return t.Damage == 0 && t.Overkill == 0 && t.Absorbed == 0 &&
+		t.Healing == 0 && t.Overheal == 0 && t.HealAbsorbed == 0
+}
+
+// EffectiveHealing returns the healing done excluding overhealing.
+func (t *MeterTotals) EffectiveHealing() int64 {
+	return t.Healing - t.Overheal
+}
+
+// A Meter aggregates damage and healing done per source unit.  Events are
+// added one at a time, so a Meter can be used while streaming a log with a
+// Reader as well as over a CombatLog or Encounter.
+type Meter struct {
+	// Units holds the totals for each source unit, keyed by GUID.
+	Units map[GUID]*MeterTotals
+
+	// If Owners is set, damage and healing done by pets and guardians is
+	// credited to their owner.  The Meter does not add events to Owners.
+	Owners *Owners
+
+	// The time range (in nanoseconds) over which rates are computed
+	start, end int64
+	fixed      bool
+	empty      bool
+
+	// Events credited to an owner which have not been removed, in order
+	credits        []credit
+	added, removed int64 // number of events counted by Add and Remove
+}
+
+// NewMeter returns an empty Meter.  Unless SetRange is called, the duration
+// of the meter is the time between the first and last events added to it.
+func NewMeter() *Meter {
+	return &Meter{
+		Units: map[GUID]*MeterTotals{},
+		empty: true,
+	}
+}
+
+// SetRange fixes the time range used to compute per-second rates.
+func (m *Meter) SetRange(start, end time.Time) {
+	m.start, m.end = start.Nanoseconds(), end.Nanoseconds()
+	m.fixed = true
+}
+
+// Duration returns the length of the meter's time range in nanoseconds.
+func (m *Meter) Duration() int64 {
+	return m.end - m.start
+}
+
+// Add adds the damage or healing done by e (if any) to the meter.
+func (m *Meter) Add(e Event) {
+	if !m.fixed {
+		ns := e.Time.Nanoseconds()
+		if m.empty || ns < m.start {
+			m.start = ns
+		}
+		if m.empty || ns > m.end {
+			m.end = ns
+		}
+		m.empty = false
+	}
+
+	u, ok := metered(e)
+	if !ok {
+		return
+	}
+	m.added++
+	if m.Owners != nil {
+		if owner := m.Owners.Owner(u); owner.ID != u.ID {
+			m.credits = append(m.credits, credit{m.added, owner})
+			u = owner
+		}
+	}
+	m.count(e, u, 1)
+}
+
+// Remove subtracts the damage or healing done by e from the meter, so that
+// a Meter can be used as the Aggregator for CombatLog.Windows.  Events must
+// be removed in the order they were added, as Windows does, and are taken
+// from the unit they were credited to when added.  Units left with nothing
+// are deleted.  Remove does not change the meter's time range, which should
+// be set with SetRange for each window.
+func (m *Meter) Remove(e Event) {
+	u, ok := metered(e)
+	if !ok {
+		return
+	}
+	m.removed++
+	if len(m.credits) > 0 && m.credits[0].seq == m.removed {
+		u = m.credits[0].unit
+		m.credits = m.credits[1:]
+	}
+	t := m.count(e, u, -1)
+	if t.isZero() {
+		m.Units[u.ID] = nil, false
+	}
+}
+
+// A credit records that the seq'th event counted by a Meter was credited to
+// the owner of its source.
+type credit struct {
+	seq  int64
+	unit Unit
+}
+
+// metered returns the source of e if it did damage or healing.
+func metered(e Event) (Unit, bool) {
+	src, ok := e.Data.(participants)
+	if !ok {
+		return Unit{}, false
+	}
+	_, dmg := e.Data.(damaged)
+	_, heal := e.Data.(healed)
+	return src.GetSource(), dmg || heal
+}
+
+// count adds sign times the damage or healing done by e to the totals of u,
+// and returns them.
+func (m *Meter) count(e Event, u Unit, sign int64) *MeterTotals {
+	t := m.totals(u)
+	if d, ok := e.Data.(damaged); ok {
+		dmg := d.GetDamage()
+		t.Damage += sign * dmg.Amount
+		t.Absorbed += sign * dmg.Absorbed
+		if dmg.Overkill > 0 {
+			t.Overkill += sign * int64(dmg.Overkill)
+		}
+	}
+	if h, ok := e.Data.(healed); ok {
+		heal := h.GetHeal()
+		t.Healing += sign * heal.Amount
+		t.Overheal += sign * heal.Overheal
+		t.HealAbsorbed += sign * heal.Absorbed
+	}
+	return t
+}
+
+// AddAll adds every event in cl to the meter.
+func (m *Meter) AddAll(cl CombatLog) {
+	for _, e := range cl {
+		m.Add(e)
+	}
+}
+
+func (m *Meter) totals(u Unit) *MeterTotals {
+	t, ok := m.Units[u.ID]
+	if !ok {
+		t = &MeterTotals{Unit: u}
+		m.Units[u.ID] = t
+	}
+	return t
+}
+
+// rate returns amount per second over the meter's duration.
+func (m *Meter) rate(amount int64) float64 {
+	dur := m.Duration()
+	if dur <= 0 {
+		return 0
+	}
+	return float64(amount) / (float64(dur) / 1e9)
+}
+
+// DPS returns the effective damage per second done by t.
+func (m *Meter) DPS(t *MeterTotals) float64 {
+	return m.rate(t.EffectiveDamage())
+}
+
+// HPS returns the effective healing per second done by t.
+func (m *Meter) HPS(t *MeterTotals) float64 {
+	return m.rate(t.EffectiveHealing())
+}
+
+// ByDamage returns the units which did damage, sorted by effective damage
+// in decreasing order.
+func (m *Meter) ByDamage() []*MeterTotals {
+	var list byDamage
+	for _, t := range m.Units {
+		if t.Damage > 0 {
+			list = append(list, t)
+		}
+	}
+	sort.Sort(list)
+	return list
+}
+
+// ByHealing returns the units which did healing, sorted by effective
+// healing in decreasing order.
+func (m *Meter) ByHealing() []*MeterTotals {
+	var list byHealing
+	for _, t := range m.Units {
+		if t.Healing > 0 {
+			list = append(list, t)
+		}
+	}
+	sort.Sort(list)
+	return list
+}
+
+type byDamage []*MeterTotals
+
+func (l byDamage) Len() int           { return len(l) }
+func (l byDamage) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byDamage) Less(i, j int) bool { return l[i].EffectiveDamage() > l[j].EffectiveDamage() }
+
+type byHealing []*MeterTotals
+
+func (l byHealing) Len() int           { return len(l) }
+func (l byHealing) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byHealing) Less(i, j int) bool { return l[i].EffectiveHealing() > l[j].EffectiveHealing() }
+
+// Meter returns a Meter over every event in the log.
+func (cl CombatLog) Meter() *Meter {
+	m := NewMeter()
+	m.AddAll(cl)
+	return m
+}
+
+// Between returns the slice of the log with events from start (inclusive)
+// to end (exclusive).  The log must be in time order.
+func (cl CombatLog) Between(start, end time.Time) CombatLog {
+	from, to := start.Nanoseconds(), end.Nanoseconds()
+	i := 0
+	for i < len(cl) && cl[i].Time.Nanoseconds() < from {
+		i++
+	}
+	j := i
+	for j < len(cl) && cl[j].Time.Nanoseconds() < to {
+		j++
+	}
+	return cl[i:j]
+}
+
+// Meter returns a Meter over the encounter, whose rates are computed over
+// the full duration of the encounter.
+func (e Encounter) Meter() *Meter {
+	m := NewMeter()
+	m.SetRange(e.Start, e.End)
+	m.AddAll(e.Events)
+	return m
+}
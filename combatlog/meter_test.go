@@ -0,0 +1,143 @@
+package combatlog
+
+import (
+	"testing"
+)
+
+func heal(sec int, src, dst Unit, amount, overheal int64) Event {
+	return Event{
+		Time: at(0, sec),
+		Name: "SPELL_HEAL",
+		Data: SpellHeal{
+			Common: Common{Source: src, Dest: dst},
+			Heal:   Heal{Amount: amount, Overheal: overheal},
+		},
+	}
+}
+
+func TestMeter(t *testing.T) {
+	healer := Unit{ID: "Player-1-00000002", Name: "Healer", Flags: UnitRaid}
+
+	killingBlow := hit(at(0, 10), testRaider, testAdd, 300)
+	swing := killingBlow.Data.(SwingDamage)
+	swing.Overkill = 100
+	killingBlow.Data = swing
+
+	cl := CombatLog{
+		hit(at(0, 0), testRaider, testBoss, 200),
+		hit(at(0, 1), testBoss, testRaider, 1000),
+		heal(2, healer, testRaider, 800, 0),
+		heal(4, healer, testRaider, 500, 300),
+		killingBlow,
+	}
+
+	m := cl.Meter()
+	if got, want := m.Duration(), int64(10e9); got != want {
+		t.Errorf("duration = %d, want %d", got, want)
+	}
+
+	dmg := m.ByDamage()
+	if got, want := len(dmg), 2; got != want {
+		t.Fatalf("got %d damage entries, want %d", got, want)
+	}
+	if got, want := dmg[0].Unit.Name, "Boss"; got != want {
+		t.Errorf("top damage = %q, want %q", got, want)
+	}
+	raider := dmg[1]
+	if raider.Damage != 500 || raider.Overkill != 100 || raider.EffectiveDamage() != 400 {
+		t.Errorf("raider damage = %d (%d overkill), want 500 (100 overkill)", raider.Damage, raider.Overkill)
+	}
+	if got, want := m.DPS(raider), 40.0; got != want {
+		t.Errorf("raider dps = %v, want %v", got, want)
+	}
+
+	heals := m.ByHealing()
+	if got, want := len(heals), 1; got != want {
+		t.Fatalf("got %d healing entries, want %d", got, want)
+	}
+	if h := heals[0]; h.Healing != 1300 || h.Overheal != 300 || h.EffectiveHealing() != 1000 {
+		t.Errorf("healing = %d (%d overheal), want 1300 (300 overheal)", h.Healing, h.Overheal)
+	}
+	if got, want := m.HPS(heals[0]), 100.0; got != want {
+		t.Errorf("hps = %v, want %v", got, want)
+	}
+}
+
+func TestMeterOwners(t *testing.T) {
+	hunter := Unit{ID: "Player-1-00000003", Name: "Hunter", Flags: UnitRaid}
+	pet := Unit{ID: "Pet-0-1-1-1-165189-1", Name: "Wolf", Flags: UnitRaid}
+	totem := Unit{ID: "Creature-0-1-1-1-300-3", Name: "Totem", Flags: UnitRaid}
+
+	cl := CombatLog{
+		{Time: at(0, 0), Name: "SPELL_SUMMON", Data: SpellSummon{Common: Common{Source: hunter, Dest: pet}}},
+		{Time: at(0, 1), Name: "SPELL_SUMMON", Data: SpellSummon{Common: Common{Source: pet, Dest: totem}}},
+		hit(at(0, 2), hunter, testBoss, 100),
+		hit(at(0, 3), pet, testBoss, 50),
+		hit(at(0, 4), totem, testBoss, 25),
+	}
+
+	owners := cl.Owners()
+	if got := owners.Owner(totem); got.ID != hunter.ID {
+		t.Errorf("owner(totem) = %q, want %q", got.Name, hunter.Name)
+	}
+	if got, want := len(owners.Pets(hunter)), 2; got != want {
+		t.Errorf("len(pets(hunter)) = %d, want %d", got, want)
+	}
+
+	m := NewMeter()
+	m.Owners = owners
+	m.AddAll(cl)
+	if got, want := len(m.Units), 1; got != want {
+		t.Fatalf("got %d units, want %d", got, want)
+	}
+	if got, want := m.Units[hunter.ID].Damage, int64(175); got != want {
+		t.Errorf("hunter damage = %d, want %d", got, want)
+	}
+}
+
+func TestMeterWindows(t *testing.T) {
+	hunter := Unit{ID: "Player-1-00000003", Name: "Hunter", Flags: UnitRaid}
+	pet := Unit{ID: "Pet-0-1-1-1-165189-1", Name: "Wolf", Flags: UnitRaid}
+	summon := Event{Time: at(0, 3), Name: "SPELL_SUMMON", Data: SpellSummon{Common: Common{Source: hunter, Dest: pet}}}
+
+	cl := CombatLog{
+		hit(at(0, 0), pet, testBoss, 50),
+		hit(at(0, 1), hunter, testBoss, 100),
+		hit(at(0, 6), pet, testBoss, 30),
+		hit(at(0, 12), pet, testBoss, 20),
+	}
+
+	// The pet's owner is only learned after the first window, so its
+	// earlier damage stays with the pet until it leaves the window.
+	want := []map[GUID]int64{
+		{pet.ID: 80, hunter.ID: 100},
+		{pet.ID: 30, hunter.ID: 20},
+		{hunter.ID: 20},
+	}
+	m := NewMeter()
+	m.Owners = NewOwners()
+	i := 0
+	cl.Windows(WindowOptions{Kind: Sliding, Size: 10e9, Step: 5e9, Aggregator: m}, func(w Window) {
+		if i >= len(want) {
+			t.Fatalf("too many windows")
+		}
+		if len(m.Units) != len(want[i]) {
+			t.Errorf("window %d: got %d units, want %d", i, len(m.Units), len(want[i]))
+		}
+		for id, dmg := range want[i] {
+			if got, ok := m.Units[id]; !ok || got.Damage != dmg {
+				t.Errorf("window %d: damage by %s = %v, want %d", i, id, got, dmg)
+			}
+		}
+		if i == 0 {
+			m.Owners.Add(summon)
+		}
+		i++
+	})
+	if i != len(want) {
+		t.Errorf("got %d windows, want %d", i, len(want))
+	}
+	if len(m.Units) != 0 {
+		t.Errorf("%d units left after the last window", len(m.Units))
+	}
+}
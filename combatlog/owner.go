@@ -0,0 +1,88 @@
+package combatlog
+
+// Owners tracks which units own pets, totems and guardians, so that their
+// actions can be credited to the owner.  Ownership is learned from
+// SPELL_SUMMON events and, when advanced logging is enabled, from the owner
+// GUID in the advanced block.
+//
+// Events are added one at a time with Add, so Owners can be kept up to date
+// while streaming a log.  CombatLog.Owners builds one from a finished log.
+type Owners struct {
+	owner map[GUID]GUID
+	units map[GUID]Unit
+}
+
+// NewOwners returns an empty ownership resolver.
+func NewOwners() *Owners {
+	return &Owners{
+		owner: map[GUID]GUID{},
+		units: map[GUID]Unit{},
+	}
+}
+
+// Add learns any ownership information present in e.
+func (o *Owners) Add(e Event) {
+	p, ok := e.Data.(participants)
+	if !ok {
+		return
+	}
+	src, dst := p.GetSource(), p.GetDest()
+	o.see(src)
+	o.see(dst)
+
+	if _, ok := e.Data.(SpellSummon); ok && !src.ID.IsZero() && !dst.ID.IsZero() {
+		o.owner[dst.ID] = src.ID
+	}
+	if a, ok := e.Data.(interface {
+		GetAdvanced() Advanced
+	}); ok {
+		adv := a.GetAdvanced()
+		if !adv.InfoGUID.IsZero() && !adv.OwnerGUID.IsZero() && adv.InfoGUID != adv.OwnerGUID {
+			o.owner[adv.InfoGUID] = adv.OwnerGUID
+		}
+	}
+}
+
+// see remembers the most recent name and flags for u.
+func (o *Owners) see(u Unit) {
+	if !u.ID.IsZero() {
+		o.units[u.ID] = u
+	}
+}
+
+// Owner returns the unit which ultimately owns u (following chains such as
+// a totem summoned by a pet), or u itself if it has no known owner.
+func (o *Owners) Owner(u Unit) Unit {
+	id, ok := o.owner[u.ID]
+	for hops := 0; ok && hops < 8; hops++ {
+		owner, known := o.units[id]
+		if !known {
+			owner = Unit{ID: id}
+		}
+		u = owner
+		id, ok = o.owner[u.ID]
+	}
+	return u
+}
+
+// Pets returns the units known to be owned (directly or indirectly) by u.
+func (o *Owners) Pets(u Unit) (pets []Unit) {
+	for pet := range o.owner {
+		if pet == u.ID {
+			continue
+		}
+		if o.Owner(Unit{ID: pet}).ID == u.ID {
+			pets = append(pets, o.units[pet])
+		}
+	}
+	return pets
+}
+
+// Owners builds an ownership resolver from every event in the log.
+func (cl CombatLog) Owners() *Owners {
+	o := NewOwners()
+	for _, e := range cl {
+		o.Add(e)
+	}
+	return o
+}
@@ -0,0 +1,160 @@
+package combatlog
+
+import (
+	"os"
+)
+
+// ParallelBatch is the number of lines handed to a decoding goroutine at a
+// time when Reader.Workers is greater than one.
+const ParallelBatch = 1024
+
+// A lineBatch is a run of consecutive lines which are all decoded with the
+// same layout.  A batch ends after a COMBAT_LOG_VERSION line, since it may
+// change the layout of the lines after it.
+type lineBatch struct {
+	lines   []rawLine
+	version LogVersion // the header the lines follow
+	err     os.Error   // read error after the last line, if any
+
+	decoded []decodedLine
+	done    chan bool // signalled once decoded is filled in
+}
+
+// A pipeline decodes lines on several goroutines.  One goroutine reads the
+// log and splits it into batches, which are sent both to the workers and,
+// in log order, to Next.  Next waits for each batch in turn, so events are
+// returned in the order they were written however the work is scheduled.
+type pipeline struct {
+	work    chan *lineBatch
+	ordered chan *lineBatch
+	quit    chan bool
+	stopped chan bool // closed when readBatches returns
+
+	batch *lineBatch // the batch being returned by Next
+	pos   int
+}
+
+func (r *Reader) startPipeline() {
+	n := r.Workers
+	p := &pipeline{
+		work:    make(chan *lineBatch, n),
+		ordered: make(chan *lineBatch, 2*n),
+		quit:    make(chan bool),
+		stopped: make(chan bool),
+	}
+	r.pipe = p
+
+	for i := 0; i < n; i++ {
+		go decodeBatches(p.work, r.Filter)
+	}
+	go r.readBatches(p, r.version)
+}
+
+// stopPipeline stops the goroutines started by startPipeline, if any, and
+// waits until r is no longer being read.
+func (r *Reader) stopPipeline() {
+	if r.pipe != nil && r.pipe.quit != nil {
+		close(r.pipe.quit)
+		r.pipe.quit = nil
+		<-r.pipe.stopped
+	}
+}
+
+// readBatches reads the log into batches until it ends or the pipeline is
+// stopped.  It is the only goroutine which reads from r while the pipeline
+// is running, and it only touches the position of the next line.
+func (r *Reader) readBatches(p *pipeline, version LogVersion) {
+	quit := p.quit
+	defer close(p.stopped)
+	defer close(p.ordered)
+	defer close(p.work)
+
+	for eof := false; !eof; {
+		b := &lineBatch{
+			version: version,
+			done:    make(chan bool, 1),
+		}
+		for len(b.lines) < ParallelBatch {
+			l, err := r.readLine(false)
+			if err != nil {
+				if err != os.EOF {
+					b.err = err
+				}
+				eof = true
+				break
+			}
+			b.lines = append(b.lines, l)
+
+			// Errors are reported when the line is decoded
+			if _, name, csv, ok := splitLine(l.text); ok && name == LogVersionEvent {
+				if v, err := parseLogVersion(csv); err == nil {
+					version = v
+					break
+				}
+			}
+		}
+
+		select {
+		case p.ordered <- b:
+		case <-quit:
+			return
+		}
+		select {
+		case p.work <- b:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// decodeBatches decodes the batches sent on work until it is closed.
+func decodeBatches(work <-chan *lineBatch, f *Filter) {
+	strings := newInterner()
+	for b := range work {
+		b.decoded = make([]decodedLine, len(b.lines))
+		for i, l := range b.lines {
+			b.decoded[i] = decodeLine(l, b.version, f, strings)
+		}
+		b.done <- true
+	}
+}
+
+// nextParallel is Next for a Reader with more than one worker.
+func (r *Reader) nextParallel() bool {
+	if r.pipe == nil {
+		r.startPipeline()
+	}
+	p := r.pipe
+	if p.quit == nil {
+		// Stopped by Close
+		return false
+	}
+
+	for {
+		if b := p.batch; b != nil {
+			for p.pos < len(b.decoded) {
+				d := &b.decoded[p.pos]
+				p.pos++
+				if r.accept(d) {
+					return true
+				}
+				if r.err != nil || r.past {
+					r.stopPipeline()
+					return false
+				}
+			}
+			if b.err != nil {
+				r.err = b.err
+				return false
+			}
+		}
+
+		b, ok := <-p.ordered
+		if !ok {
+			return false
+		}
+		<-b.done
+		p.batch, p.pos = b, 0
+	}
+	panic("unreachable")
+}
@@ -1,329 +1,500 @@
 package combatlog
 
 import (
-	"bufio"
 	"fmt"
 	"gob"
 	"io"
 	"os"
 	"reflect"
-	"strings"
+	"runtime"
 	"strconv"
 	"time"
+	"unsafe"
 )
 
 const (
-	TimeStampFormat = "1/2 15:04:05.000"
+	TimeStampFormat     = "1/2 15:04:05.000"
+	TimeStampYearFormat = "1/2/2006 15:04:05.000" // newer clients
+	ReadBufferSize      = 4 * 1024 * 1024         // 4MB
+
+	// Older constants, which only hold for TimeStampFormat
 	TimeStampPrefix = 11
-	StartOfEvent    = len(TimeStampFormat)+2
-	ReadBufferSize  = 4 * 1024 * 1024 // 4MB
+	StartOfEvent    = len(TimeStampFormat) + 2
 )
 
 type Event struct {
 	Time time.Time
 	Name string
 	Data interface{}
+
+	// Form records how the line the event was read from was written, so
+	// that a Writer can write it the same way.
+	Form LineForm
+}
+
+// A LineForm records details of how an event's line was written which the
+// rest of the Event does not.  Lines written in the form a Writer would use
+// anyway have the zero LineForm, as do events which were not read from a
+// log.
+type LineForm struct {
+	// Fields is the number of CSV fields on the line if it ended with
+	// optional fields which are zero, and otherwise 0.
+	Fields int
+
+	// NoYear and NoZone are set if the Reader filled in the year or zone
+	// of the event's time because the timestamp did not include it.
+	NoYear, NoZone bool
 }
 
 type CombatLog []Event
 
+// ReadFile reads the entire combat log in filename into memory, using Open to
+// determine the year of its events.  Lines are decoded on GOMAXPROCS
+// goroutines.  Use Open to process large logs one event at a time.
 func ReadFile(filename string) (CombatLog, os.Error) {
-	file, err := os.Open(filename)
+	r, err := Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	return Read(file)
-	/*
-		cl, err := Read(file)
-		buf := new(bytes.Buffer)
-		if err := gob.NewEncoder(buf).Encode(cl); err != nil {
-			return nil, err
-		}
-		fmt.Println("%s: encodes to %d bytes", buf.Len())
-		return cl, err
-	*/
+	defer r.Close()
+	r.Workers = runtime.GOMAXPROCS(0)
+	return r.readAll()
 }
 
 func start_of_event(rune int) bool {
 	return rune >= '@'
 }
 
+// Read reads every event in r into memory.  It is a convenience wrapper
+// around Reader.
 func Read(r io.Reader) (events CombatLog, err os.Error) {
-	lines, err := bufio.NewReaderSize(r, ReadBufferSize)
-	if err != nil {
+	return NewReader(r).readAll()
+}
+
+func (r *Reader) readAll() (events CombatLog, err os.Error) {
+	for r.Next() {
+		events = append(events, r.Event())
+	}
+	if err := r.Err(); err != nil {
 		return nil, err
 	}
+	return events, nil
+}
 
-	var lastTime *time.Time
-	var lastStamp = ".................."
-
-	for {
-		// Read the next line
-		line, isPrefix, err := lines.ReadLine()
-		if err == os.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		lstr := string(line)
-
-		// error if it's super long
-		if isPrefix {
-			return nil, fmt.Errorf("combatlog: long line: %q\n", line)
-		}
-
-		// Skip the line if it's blank
-		if len(lstr) == 0 {
-			continue
-		}
-
-		// Figure out where the event starts
-		start := len(TimeStampFormat) + strings.IndexFunc(lstr[len(TimeStampFormat):], start_of_event)
-		if start < 0 {
-			fmt.Printf("combatlog: malformatted line: %q\n", lstr)
-			continue
-		}
-
-		// Cache the 
-		var etime *time.Time
-		stamp := strings.TrimSpace(lstr[:start])
-		if lastStamp[:TimeStampPrefix] != stamp[:TimeStampPrefix] {
-			etime, err = time.Parse(TimeStampFormat, stamp)
-			if err != nil {
-				return nil, fmt.Errorf("combatlog: bad timestamp %q: %s", stamp, err)
-			}
-		} else {
-			etime = lastTime
-			suffix := stamp[TimeStampPrefix:]
-			if len(suffix) != 6 {
-				return nil, fmt.Errorf("combatlog: bad timestamp %q: invalid ss.mmm", stamp, err)
-			}
-			sufSec, sufMsec := suffix[:2], suffix[3:]
-			sec, err := strconv.Atoi(sufSec)
-			if err != nil {
-				return nil, fmt.Errorf("combatlog: bad timestamp %q: %s", stamp, err)
-			}
-			msec, err := strconv.Atoi(sufMsec)
-			if err != nil {
-				return nil, fmt.Errorf("combatlog: bad timestamp %q: %s", stamp, err)
-			}
-			etime.Second, etime.Nanosecond = sec, msec*1e6
-		}
-
-		lastTime = etime
-		lastStamp = stamp
-
-		csv := lstr[start:]
-		comma := strings.IndexRune(csv, ',')
-		if comma < 0 {
-			fmt.Printf("combatlog: malformatted line: %q\n", lstr)
-			continue
-		}
+// A field decodes one CSV field into the event at base.  Fields hold the
+// offset of their value rather than a pointer, so that a factory can decode
+// into any struct of its type and be shared between goroutines.  Names and
+// GUIDs are looked up in the interner.
+type field interface {
+	parse(base unsafe.Pointer, fstr string, in *interner) os.Error
+	format(base unsafe.Pointer) string
+	isZero(base unsafe.Pointer) bool
+}
 
-		name, csv := csv[:comma], csv[comma+1:]
-		factory, ok := eventTypes[name]
-		if !ok {
-			return nil, fmt.Errorf("combatlog: unknown event type %q", name)
-		}
+// fieldAddr returns the address off bytes into the struct at base.
+func fieldAddr(base unsafe.Pointer, off uintptr) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(base) + off)
+}
 
-		data, err := factory.create(csv)
-		if err != nil {
-			return nil, err
-		}
+// A validator is implemented by field types (such as MissType) which
+// restrict the values they can hold.  It is called with the raw field before
+// parsing and returns the canonical form of the value.
+type validator interface {
+	validate(fstr string) (string, os.Error)
+}
 
-		event := Event{
-			Time: *etime,
-			Name: name,
-			Data: data,
-		}
+type fieldValidated struct {
+	field
+	v validator
+}
 
-		events = append(events, event)
+func (f fieldValidated) parse(base unsafe.Pointer, fstr string, in *interner) os.Error {
+	fstr, err := f.v.validate(fstr)
+	if err != nil {
+		return err
 	}
+	return f.field.parse(base, fstr, in)
+}
 
-	return events, nil
+// A fieldLayout is the ordered list of fields which make up an event's CSV
+// representation.
+type fieldLayout struct {
+	fields   []field
+	names    []string // e.g. "SpellDamage.Damage.Amount"
+	min, max int
 }
 
-type field interface {
-	parse(string) os.Error
-	zero()
+// add appends f to the layout.
+func (l *fieldLayout) add(f field, name string, optional bool) {
+	if !optional {
+		l.min++
+	}
+	l.max++
+	l.fields = append(l.fields, f)
+	l.names = append(l.names, name)
 }
 
+// An eventFactory decodes and formats one type of event.  It is not modified
+// after compile, so it is safe to use from multiple goroutines.
 type eventFactory struct {
-	fields   []field
-	min, max int
-	emptyPtr interface{}
+	basic    fieldLayout // the classic log layout, without a header
+	modern   fieldLayout // the layout after a COMBAT_LOG_VERSION header
+	advanced fieldLayout // the layout when advanced logging is enabled
+	units    bool        // whether the event starts with a Common
 	emptyTyp reflect.Type
+	zero     reflect.Value // the zero event, used to reset events in decode
 }
 
 func (e eventFactory) String() string {
-	return fmt.Sprintf("%T%v", e.emptyPtr, e.fields)
+	return fmt.Sprintf("%v%v", e.emptyTyp, e.advanced.fields)
+}
+
+// layout returns the fields of the event in a log with the header v.  The
+// zero LogVersion is that of a classic log, which has no header.
+func (e eventFactory) layout(v LogVersion) fieldLayout {
+	switch {
+	case v.Advanced:
+		return e.advanced
+	case v.Version > 0:
+		return e.modern
+	}
+	return e.basic
+}
+
+// create decodes csv into a new event, using the layout for the header v.
+// The form of the line is returned in case the event alone would not be
+// written back the same way.
+func (e eventFactory) create(csv string, v LogVersion, in *interner) (interface{}, LineForm, os.Error) {
+	var form LineForm
+	val := reflect.New(e.emptyTyp)
+	n, err := e.decode(val, csv, v, in)
+	if err != nil {
+		return nil, form, err
+	}
+	if n > e.layout(v).length(unsafe.Pointer(val.Pointer())) {
+		form.Fields = n
+	}
+	return val.Elem().Interface(), form, nil
 }
 
-func (e eventFactory) create(csv string) (event interface{}, err os.Error) {
+// decode decodes csv into the event ptr points to, which must be of the
+// factory's type, and returns the number of fields decoded.  Fields which
+// are not present are zeroed.  It does not allocate unless a string is seen
+// for the first time.
+func (e eventFactory) decode(ptr reflect.Value, csv string, v LogVersion, in *interner) (parsed int, err os.Error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %s", r)
+			err = &ParseError{Field: -1, Err: fmt.Errorf("panic: %s", r)}
 		}
 	}()
 
-	start := 0
-	parsed := 0
+	layout := e.layout(v)
+
+	// Zero the event so no fields are left over from a previous one.  This
+	// is a typed copy, since the event holds strings and slices.
+	ptr.Elem().Set(e.zero)
+	base := unsafe.Pointer(ptr.Pointer())
 
-	for i, field := range e.fields {
+	start := 0
+	for i, field := range layout.fields {
 		if start >= len(csv) {
 			break
 		}
 		comma := nextField(csv[start:])
-		fstr := string(csv[start:][:comma])
+		fstr := csv[start:][:comma]
 
-		if err := field.parse(fstr); err != nil {
-			return nil, fmt.Errorf("combatlog: failed to parse %q as %T for %T[%d]: %s",
-				fstr, field, e.emptyPtr, i, err)
+		if err := field.parse(base, fstr, in); err != nil {
+			return parsed, &ParseError{
+				Field:     i,
+				FieldName: layout.names[i],
+				Err:       fmt.Errorf("bad value %q: %s", fstr, err),
+			}
 		}
 
 		parsed++
 		start += comma + 1
 	}
 
-	if parsed < e.min || parsed > e.max {
-		return nil, fmt.Errorf("combatlog: event has %d fields, it should have %d-%d:\n%s\n%s",
-			parsed, e.min, e.max, e, string(csv))
+	if parsed < layout.min || parsed > layout.max {
+		return parsed, &ParseError{
+			Field: -1,
+			Err: fmt.Errorf("%s has %d fields, it should have %d-%d",
+				e.emptyTyp.Name(), parsed, layout.min, layout.max),
+		}
 	}
+	return parsed, nil
+}
 
-	for i := parsed; i < e.max; i++ {
-		e.fields[i].zero()
+// formatInt formats i in decimal or, for flags, hex.
+func formatInt(i int64, bits uint, hex bool) string {
+	if hex {
+		return "0x" + strconv.Uitob64(uint64(i)&(1<<bits-1), 16)
 	}
-
-	copied := reflect.New(e.emptyTyp).Elem()
-	copied.Set(reflect.ValueOf(e.emptyPtr).Elem())
-
-	return copied.Interface(), nil
+	return strconv.Itoa64(i)
 }
 
-type fieldInt32 struct{ ptr *int32 }
+type fieldInt32 struct {
+	off uintptr
+	hex bool
+}
 
-func (f fieldInt32) zero() {
-	*f.ptr = 0
+func (f fieldInt32) isZero(base unsafe.Pointer) bool {
+	return *(*int32)(fieldAddr(base, f.off)) == 0
 }
-func (f fieldInt32) parse(fstr string) os.Error {
+func (f fieldInt32) format(base unsafe.Pointer) string {
+	return formatInt(int64(*(*int32)(fieldAddr(base, f.off))), 32, f.hex)
+}
+func (f fieldInt32) parse(base unsafe.Pointer, fstr string, in *interner) os.Error {
 	i, err := strconv.Btoi64(fstr, 0)
-	*f.ptr = int32(i)
+	*(*int32)(fieldAddr(base, f.off)) = int32(i)
 	return err
 }
 
-type fieldInt64 struct{ ptr *int64 }
+type fieldInt64 struct {
+	off uintptr
+	hex bool
+}
 
-func (f fieldInt64) zero() {
-	*f.ptr = 0
+func (f fieldInt64) isZero(base unsafe.Pointer) bool {
+	return *(*int64)(fieldAddr(base, f.off)) == 0
 }
-func (f fieldInt64) parse(fstr string) (err os.Error) {
-	*f.ptr, err = strconv.Btoi64(fstr, 0)
+func (f fieldInt64) format(base unsafe.Pointer) string {
+	return formatInt(*(*int64)(fieldAddr(base, f.off)), 64, f.hex)
+}
+func (f fieldInt64) parse(base unsafe.Pointer, fstr string, in *interner) (err os.Error) {
+	*(*int64)(fieldAddr(base, f.off)), err = strconv.Btoi64(fstr, 0)
 	return err
 }
 
-type fieldUint32 struct{ ptr *uint32 }
+type fieldUint32 struct {
+	off uintptr
+	hex bool
+}
 
-func (f fieldUint32) zero() {
-	*f.ptr = 0
+func (f fieldUint32) isZero(base unsafe.Pointer) bool {
+	return *(*uint32)(fieldAddr(base, f.off)) == 0
+}
+func (f fieldUint32) format(base unsafe.Pointer) string {
+	return formatInt(int64(*(*uint32)(fieldAddr(base, f.off))), 32, f.hex)
 }
-func (f fieldUint32) parse(fstr string) os.Error {
+func (f fieldUint32) parse(base unsafe.Pointer, fstr string, in *interner) os.Error {
 	i, err := strconv.Btoui64(fstr, 0)
-	*f.ptr = uint32(i)
+	*(*uint32)(fieldAddr(base, f.off)) = uint32(i)
 	return err
 }
 
-type fieldUint64 struct{ ptr *uint64 }
+type fieldUint64 struct {
+	off uintptr
+	hex bool
+}
 
-func (f fieldUint64) zero() {
-	*f.ptr = 0
+func (f fieldUint64) isZero(base unsafe.Pointer) bool {
+	return *(*uint64)(fieldAddr(base, f.off)) == 0
+}
+func (f fieldUint64) format(base unsafe.Pointer) string {
+	u := *(*uint64)(fieldAddr(base, f.off))
+	if f.hex {
+		return "0x" + strconv.Uitob64(u, 16)
+	}
+	return strconv.Uitoa64(u)
 }
-func (f fieldUint64) parse(fstr string) (err os.Error) {
-	*f.ptr, err = strconv.Btoui64(fstr, 0)
+func (f fieldUint64) parse(base unsafe.Pointer, fstr string, in *interner) (err os.Error) {
+	*(*uint64)(fieldAddr(base, f.off)), err = strconv.Btoui64(fstr, 0)
 	return err
 }
 
-type fieldString struct{ ptr *string }
+type fieldString struct {
+	off    uintptr
+	quoted bool
+	intern bool // whether values repeat often enough to be interned
+}
 
-func (f fieldString) zero() {
-	*f.ptr = ""
+func (f fieldString) isZero(base unsafe.Pointer) bool {
+	return len(*(*string)(fieldAddr(base, f.off))) == 0
 }
-func (f fieldString) parse(fstr string) (err os.Error) {
-	if fstr[0] == '"' {
-		*f.ptr, err = strconv.Unquote(fstr)
+func (f fieldString) format(base unsafe.Pointer) string {
+	s := *(*string)(fieldAddr(base, f.off))
+	// Missing names are written as a bare nil
+	if !f.quoted || s == "nil" {
+		return s
+	}
+	// The client doesn't escape names, which may not be ASCII
+	return `"` + s + `"`
+}
+func (f fieldString) parse(base unsafe.Pointer, fstr string, in *interner) (err os.Error) {
+	ptr := (*string)(fieldAddr(base, f.off))
+	if f.intern {
+		*ptr, err = in.intern(fstr)
 	} else {
-		*f.ptr = fstr
+		*ptr, err = decodeString(fstr)
 	}
 	return err
 }
 
-type fieldBool struct{ ptr *bool }
+type fieldBool struct {
+	off  uintptr
+	zero bool // false is written as 0 rather than nil
+}
 
-func (f fieldBool) zero() {
-	*f.ptr = false
+func (f fieldBool) isZero(base unsafe.Pointer) bool {
+	return !*(*bool)(fieldAddr(base, f.off))
 }
-func (f fieldBool) parse(fstr string) (err os.Error) {
+func (f fieldBool) format(base unsafe.Pointer) string {
+	switch {
+	case *(*bool)(fieldAddr(base, f.off)):
+		return "1"
+	case f.zero:
+		return "0"
+	}
+	return "nil"
+}
+func (f fieldBool) parse(base unsafe.Pointer, fstr string, in *interner) (err os.Error) {
+	ptr := (*bool)(fieldAddr(base, f.off))
 	switch fstr {
-	case "nil":
-		*f.ptr = false
+	case "nil", "0":
+		*ptr = false
 	case "1":
-		*f.ptr = true
+		*ptr = true
 	default:
 		err = fmt.Errorf("invalid bool: %q", fstr)
 	}
 	return err
 }
 
-func compile(empty interface{}) (comp eventFactory) {
-	gob.Register(empty)
+type fieldFloat64 struct{ off uintptr }
 
-	val := reflect.ValueOf(empty)
-	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
-		panic("combatlog: compile: cannot compile a non-pointer-to-struct value")
+func (f fieldFloat64) isZero(base unsafe.Pointer) bool {
+	return *(*float64)(fieldAddr(base, f.off)) == 0
+}
+func (f fieldFloat64) format(base unsafe.Pointer) string {
+	return strconv.Ftoa64(*(*float64)(fieldAddr(base, f.off)), 'f', -1)
+}
+func (f fieldFloat64) parse(base unsafe.Pointer, fstr string, in *interner) (err os.Error) {
+	*(*float64)(fieldAddr(base, f.off)), err = strconv.Atof64(fstr)
+	return err
+}
+
+// RegisterEvent adds or replaces the layout used to decode events called
+// name.  The prototype must be a pointer to a struct whose fields are laid
+// out in the same order as the event's CSV fields, like the event types in
+// this package.  Decoded events have the type of the struct, not a pointer.
+//
+// Fields may be any of the integer types used by this package, float64, bool
+// or string (or named types based on them), or structs of those.  The
+// following struct tags are understood:
+//
+//	combatlog:"optional"  this and all later fields may be omitted
+//	combatlog:"advanced"  this struct is only present with advanced logging
+//	combatlog:"modern"    this field is only present after a COMBAT_LOG_VERSION header
+//	combatlog:"hex"       this integer is written in hex (e.g. flags)
+//	combatlog:"quoted"    this string is written in quotes (e.g. names)
+//	combatlog:"zero"      this bool is written as 0 rather than nil if false
+//
+// RegisterEvent is not safe to call while events are being read; it should
+// usually be called from an init function.
+func RegisterEvent(name string, prototype interface{}) (err os.Error) {
+	if name == LogVersionEvent {
+		return fmt.Errorf("combatlog: cannot register %s", name)
 	}
-	comp.emptyPtr = val.Interface()
-	val = val.Elem()
-	comp.emptyTyp = val.Type()
 
-	optional := false
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("combatlog: register %s: %s", name, r)
+		}
+	}()
 
-	var next func([]int, reflect.Value)
-	next = func(curr []int, val reflect.Value) {
-		typ := val.Type()
+	eventTypes[name] = compile(prototype)
+	return nil
+}
 
-		for i, n := 0, val.NumField(); i < n; i++ {
-			// Get the recursive index
-			idx := make([]int, len(curr)+1)
-			idx[copy(idx, curr)] = i
+// compile builds an eventFactory for the struct pointed to by empty.  Fields
+// are decoded in declaration order, recursing into structs.  See RegisterEvent
+// for the supported field types and tags.
+func compile(empty interface{}) (comp eventFactory) {
+	ptyp := reflect.TypeOf(empty)
+	if ptyp == nil || ptyp.Kind() != reflect.Ptr || ptyp.Elem().Kind() != reflect.Struct {
+		panic("combatlog: compile: cannot compile a non-pointer-to-struct value")
+	}
+	comp.emptyTyp = ptyp.Elem()
+	comp.zero = reflect.Zero(comp.emptyTyp)
+
+	optional := false
 
-			fval := val.Field(i)
+	var next func(string, reflect.Type, uintptr, bool)
+	next = func(prefix string, typ reflect.Type, base uintptr, advanced bool) {
+		for i, n := 0, typ.NumField(); i < n; i++ {
 			ftyp := typ.Field(i)
-			if ftyp.Tag.Get("combatlog") == "optional" {
+			name := prefix + ftyp.Name
+			off := base + ftyp.Offset
+			hex, quoted, zero, modern := false, false, false, false
+			switch tag := ftyp.Tag.Get("combatlog"); tag {
+			case "":
+			case "hex":
+				hex = true
+			case "quoted":
+				quoted = true
+			case "zero":
+				zero = true
+			case "optional":
 				optional = true
+			case "modern":
+				if ftyp.Type.Kind() == reflect.Struct {
+					panic("combatlog: compile: modern tag on struct field " + ftyp.Name)
+				}
+				modern = true
+			case "advanced":
+				if ftyp.Type.Kind() != reflect.Struct {
+					panic("combatlog: compile: advanced tag on non-struct field " + ftyp.Name)
+				}
+				next(name+".", ftyp.Type, off, true)
+				continue
+			default:
+				panic("combatlog: compile: unknown tag " + strconv.Quote(tag) + " on field " + name)
 			}
 
+			// Names, GUIDs and enums repeat from line to line, so they are
+			// interned.  Other strings, such as power, are copied.
+			v, validated := reflect.Zero(ftyp.Type).Interface().(validator)
+			intern := quoted || validated || ftyp.Type == reflect.TypeOf(GUID(""))
+
+			// Fields are accessed by offset so that named types (UnitFlags,
+			// SpellSchool, etc) compile the same as their underlying type.
 			var curField field
 			switch ftyp.Type.Kind() {
-			case reflect.Struct: next(idx, fval)
-			case reflect.Int32:  curField = fieldInt32{fval.Addr().Interface().(*int32)}
-			case reflect.Int64:  curField = fieldInt64{fval.Addr().Interface().(*int64)}
-			case reflect.Uint32: curField = fieldUint32{fval.Addr().Interface().(*uint32)}
-			case reflect.Uint64: curField = fieldUint64{fval.Addr().Interface().(*uint64)}
-			case reflect.Bool:   curField = fieldBool{fval.Addr().Interface().(*bool)}
-			case reflect.String: curField = fieldString{fval.Addr().Interface().(*string)}
-			default:             panic("cannot compile field of type "+ftyp.Type.Kind().String())
+			case reflect.Struct:  next(name+".", ftyp.Type, off, advanced)
+			case reflect.Int32:   curField = fieldInt32{off, hex}
+			case reflect.Int64:   curField = fieldInt64{off, hex}
+			case reflect.Uint32:  curField = fieldUint32{off, hex}
+			case reflect.Uint64:  curField = fieldUint64{off, hex}
+			case reflect.Float64: curField = fieldFloat64{off}
+			case reflect.Bool:    curField = fieldBool{off, zero}
+			case reflect.String:  curField = fieldString{off, quoted, intern}
+			default:              panic("combatlog: compile: cannot compile field " + name + " of type " + ftyp.Type.Kind().String())
 			}
-			if curField != nil {
-				if !optional {
-					comp.min++
-				}
-				comp.max++
-				comp.fields = append(comp.fields, curField)
+			if curField == nil {
+				continue
+			}
+			if validated {
+				curField = fieldValidated{curField, v}
+			}
+			comp.advanced.add(curField, name, optional)
+			if advanced {
+				continue
+			}
+			comp.modern.add(curField, name, optional)
+			if modern {
+				continue
 			}
+			comp.basic.add(curField, name, optional)
 		}
 	}
 
-	next(nil, val)
+	next(comp.emptyTyp.Name()+".", comp.emptyTyp, 0, false)
+	if f, ok := comp.emptyTyp.FieldByName("Common"); ok && len(f.Index) == 1 && f.Index[0] == 0 {
+		comp.units = f.Type == reflect.TypeOf(Common{})
+	}
+	// Events hold values, not pointers, so that is what is encoded
+	gob.Register(reflect.Zero(comp.emptyTyp).Interface())
 	return comp
 }
 
@@ -348,3 +519,13 @@ func nextField(csv string) int {
 	}
 	return len(csv)
 }
+
+// splitFields splits csv into its fields, which are left quoted.
+func splitFields(csv string) (fields []string) {
+	for start := 0; start < len(csv); {
+		comma := nextField(csv[start:])
+		fields = append(fields, csv[start:][:comma])
+		start += comma + 1
+	}
+	return fields
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"time"
 	"testing"
 )
@@ -56,11 +57,11 @@ var decodeTests = []struct {
 					Common: Common{
 						Source: Unit{
 							Name: "Knight of the Ebon Blade",
-							ID:   0xf130966900007981, Flags: 0xa18, Null: 0,
+							ID:   GUID("0xF130966900007981"), Flags: 0xa18,
 						},
 						Dest: Unit{
 							Name: "Pustulent Horror",
-							ID:   0xf15079a30069a7d9, Flags: 0xa48, Null: 0,
+							ID:   GUID("0xF15079A30069A7D9"), Flags: 0xa48,
 						},
 					},
 					Spell: Spell{
@@ -71,7 +72,7 @@ var decodeTests = []struct {
 						Amount: 5087, School: 32,
 						Resisted: 0, Blocked: 0, Absorbed: 0,
 						Critical: false, Glancing: false, Crushing: false,
-						Unknown: -1,
+						Overkill: -1,
 					},
 				},
 			},
@@ -86,18 +87,18 @@ var decodeTests = []struct {
 					Common: Common{
 						Source: Unit{
 							Name: "Argent Warhorse",
-							ID:   0xf15096640000699c, Flags: 0xa18,
+							ID:   GUID("0xF15096640000699C"), Flags: 0xa18,
 						},
 						Dest: Unit{
 							Name: "Pustulent Horror",
-							ID:   0xf15079a30069a7d9, Flags: 0xa48,
+							ID:   GUID("0xF15079A30069A7D9"), Flags: 0xa48,
 						},
 					},
 					Damage: Damage{
 						Amount: 155, School: 1,
 						Resisted: 0, Blocked: 0, Absorbed: 0,
 						Critical: false, Glancing: false, Crushing: false,
-						Unknown: -1,
+						Overkill: -1,
 					},
 				},
 			},
@@ -121,18 +122,18 @@ var decodeTests = []struct {
 					Common: Common{
 						Source: Unit{
 							Name: "Argent Warhorse",
-							ID:   0xf15096640000699c, Flags: 0xa18,
+							ID:   GUID("0xF15096640000699C"), Flags: 0xa18,
 						},
 						Dest: Unit{
 							Name: "Pustulent Horror",
-							ID:   0xf15079a30069a7d9, Flags: 0xa48,
+							ID:   GUID("0xF15079A30069A7D9"), Flags: 0xa48,
 						},
 					},
 					Damage: Damage{
 						Amount: 155, School: 1,
 						Resisted: 0, Blocked: 0, Absorbed: 0,
 						Critical: false, Glancing: false, Crushing: false,
-						Unknown: -1,
+						Overkill: -1,
 					},
 				},
 			},
@@ -147,18 +148,199 @@ var decodeTests = []struct {
 					Common: Common{
 						Source: Unit{
 							Name: "Pustulent Horror",
-							ID:   0xf15079a30069a7d9, Flags: 0xa48,
+							ID:   GUID("0xF15079A30069A7D9"), Flags: 0xa48,
 						},
 						Dest: Unit{
 							Name: "Argent Crusader",
-							ID:   0xf130965d00687234, Flags: 0xa18,
+							ID:   GUID("0xF130965D00687234"), Flags: 0xa18,
 						},
 					},
 					Damage: Damage{
 						Amount: 1820, School: 1,
 						Resisted: 0, Blocked: 0, Absorbed: 0,
 						Critical: false, Glancing: false, Crushing: false,
-						Unknown: -1,
+						Overkill: -1,
+					},
+				},
+			},
+		},
+	},
+	{
+		Desc: "advanced logging",
+		Lines: `
+10/18 20:30:00.123  COMBAT_LOG_VERSION,20,ADVANCED_LOG_ENABLED,1,BUILD_VERSION,10.1.7,PROJECT_ID,1
+10/18 20:30:01.000  SPELL_DAMAGE,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,133,"Fireball",0x4,Creature-0-3137-1530-1234-103685-00004F2B6A,0000000000000000,950000,1000000,0,0,1200,0,0,100,100,0,-3000.5,500.25,1530,1.5,63,12000,12500,-1,4,0,0,0,1,nil,nil
+`,
+		Events: CombatLog{
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 30, Second: 0, Nanosecond: 123000000,
+				},
+				Name: "COMBAT_LOG_VERSION",
+				Data: LogVersion{
+					Version:   20,
+					Advanced:  true,
+					Build:     "10.1.7",
+					ProjectID: 1,
+				},
+			},
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 30, Second: 1, Nanosecond: 0,
+				},
+				Name: "SPELL_DAMAGE",
+				Data: SpellDamage{
+					Common: Common{
+						Source: Unit{
+							Name: "Kyle-Realm",
+							ID:   GUID("Player-1084-0A1B2C3D"), Flags: 0x512,
+						},
+						Dest: Unit{
+							Name: "Boss",
+							ID:   GUID("Creature-0-3137-1530-1234-103685-00004F2B6A"), Flags: 0x10a48,
+						},
+					},
+					Spell: Spell{
+						Name: "Fireball",
+						ID:   133, School: 4,
+					},
+					Advanced: Advanced{
+						InfoGUID:     GUID("Creature-0-3137-1530-1234-103685-00004F2B6A"),
+						OwnerGUID:    GUID("0000000000000000"),
+						CurrentHP:    950000,
+						MaxHP:        1000000,
+						Armor:        1200,
+						PowerType:    "0",
+						CurrentPower: "100",
+						MaxPower:     "100",
+						PowerCost:    "0",
+						PositionX:    -3000.5,
+						PositionY:    500.25,
+						UIMapID:      1530,
+						Facing:       1.5,
+						Level:        63,
+					},
+					Damage: Damage{
+						Amount: 12000, Unmitigated: 12500, Overkill: -1, School: 4,
+						Critical: true,
+					},
+				},
+			},
+		},
+	},
+	{
+		Desc: "modern logging",
+		Lines: `
+10/18 20:31:00.000  COMBAT_LOG_VERSION,20,ADVANCED_LOG_ENABLED,0,BUILD_VERSION,10.1.7,PROJECT_ID,1
+10/18 20:31:01.000  SWING_MISSED,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,PARRY,nil
+10/18 20:31:02.000  SPELL_MISSED,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,374361,"Ancient Fury",0x4,ABSORB,nil,21400,21400,nil
+10/18 20:31:03.000  SWING_DAMAGE,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,8210,9870,-1,1,0,0,1500,nil,nil,nil
+`,
+		Events: CombatLog{
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 31, Second: 0, Nanosecond: 0,
+				},
+				Name: "COMBAT_LOG_VERSION",
+				Data: LogVersion{
+					Version:   20,
+					Build:     "10.1.7",
+					ProjectID: 1,
+				},
+			},
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 31, Second: 1, Nanosecond: 0,
+				},
+				Name: "SWING_MISSED",
+				Data: SwingMissed{
+					Common: Common{
+						Source: Unit{
+							Name: "Boss",
+							ID:   GUID("Creature-0-3137-1530-1234-103685-00004F2B6A"), Flags: 0x10a48,
+						},
+						Dest: Unit{
+							Name: "Kyle-Realm",
+							ID:   GUID("Player-1084-0A1B2C3D"), Flags: 0x512,
+						},
+					},
+					Miss: Miss{Type: MissParry},
+				},
+			},
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 31, Second: 2, Nanosecond: 0,
+				},
+				Name: "SPELL_MISSED",
+				Data: SpellMissed{
+					Common: Common{
+						Source: Unit{
+							Name: "Boss",
+							ID:   GUID("Creature-0-3137-1530-1234-103685-00004F2B6A"), Flags: 0x10a48,
+						},
+						Dest: Unit{
+							Name: "Kyle-Realm",
+							ID:   GUID("Player-1084-0A1B2C3D"), Flags: 0x512,
+						},
+					},
+					Spell: Spell{
+						Name: "Ancient Fury",
+						ID:   374361, School: 4,
+					},
+					Miss: Miss{
+						Type: MissAbsorb, Unknown: 21400, Unmitigated: 21400,
+					},
+				},
+				Form: LineForm{Fields: 16},
+			},
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 31, Second: 3, Nanosecond: 0,
+				},
+				Name: "SWING_DAMAGE",
+				Data: SwingDamage{
+					Common: Common{
+						Source: Unit{
+							Name: "Boss",
+							ID:   GUID("Creature-0-3137-1530-1234-103685-00004F2B6A"), Flags: 0x10a48,
+						},
+						Dest: Unit{
+							Name: "Kyle-Realm",
+							ID:   GUID("Player-1084-0A1B2C3D"), Flags: 0x512,
+						},
+					},
+					Damage: Damage{
+						Amount: 8210, Unmitigated: 9870, Overkill: -1, School: 1,
+						Absorbed: 1500,
+					},
+				},
+			},
+		},
+	},
+	{
+		Desc: "unknown events",
+		Lines: `
+10/18 20:30:02.000  SPELL_EMPOWER_START,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,0000000000000000,nil,0x80000000,0x80000000,357208,"Fire Breath",0x4
+`,
+		Events: CombatLog{
+			Event{
+				Time: time.Time{
+					Year: 0, Month: 10, Day: 18,
+					Hour: 20, Minute: 30, Second: 2, Nanosecond: 0,
+				},
+				Name: "SPELL_EMPOWER_START",
+				Data: RawEvent{
+					Name: "SPELL_EMPOWER_START",
+					Fields: []string{
+						"Player-1084-0A1B2C3D", `"Kyle-Realm"`, "0x512", "0x0",
+						"0000000000000000", "nil", "0x80000000", "0x80000000",
+						"357208", `"Fire Breath"`, "0x4",
 					},
 				},
 			},
@@ -186,6 +368,464 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestReader(t *testing.T) {
+	for _, test := range decodeTests {
+		r := NewReader(bytes.NewBufferString(test.Lines))
+		idx := 0
+		for r.Next() {
+			if idx >= len(test.Events) {
+				t.Errorf("%s: extra event %#v", test.Desc, r.Event())
+				continue
+			}
+			if got, want := r.Event(), test.Events[idx]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: event %d:\n got: %#v\nwant: %#v", test.Desc, idx, got, want)
+			}
+			idx++
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: error: %s", test.Desc, err)
+		}
+		if idx != len(test.Events) {
+			t.Errorf("%s: got %d events, want %d", test.Desc, idx, len(test.Events))
+		}
+	}
+}
+
+func TestReaderParallel(t *testing.T) {
+	// Repeat the tests with a header so that the log spans several batches,
+	// turning advanced logging on and off.
+	lines := decodeTests[0].Lines + decodeTests[1].Lines
+	for n := 0; n < 3*ParallelBatch; {
+		for _, test := range decodeTests[2:] {
+			lines += test.Lines
+			n += len(test.Events)
+		}
+	}
+
+	want, err := Read(bytes.NewBufferString(lines))
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+
+	r := NewReader(bytes.NewBufferString(lines))
+	r.Workers = 4
+	defer r.Close()
+	idx := 0
+	for r.Next() {
+		if idx >= len(want) {
+			t.Errorf("extra event %#v", r.Event())
+			continue
+		}
+		if got := r.Event(); !reflect.DeepEqual(got, want[idx]) {
+			t.Errorf("event %d:\n got: %#v\nwant: %#v", idx, got, want[idx])
+		}
+		idx++
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("error: %s", err)
+	}
+	if idx != len(want) {
+		t.Errorf("got %d events, want %d", idx, len(want))
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, test := range decodeTests {
+		r := NewReader(bytes.NewBufferString(test.Lines))
+		idx := 0
+		for r.Scan() {
+			if idx >= len(test.Events) {
+				t.Errorf("%s: extra event %s", test.Desc, r.Name())
+				continue
+			}
+			want := test.Events[idx]
+			idx++
+			if _, ok := want.Data.(RawEvent); ok {
+				continue
+			}
+			dst := reflect.New(reflect.TypeOf(want.Data))
+			if err := r.Decode(dst.Interface()); err != nil {
+				t.Errorf("%s: event %d: decode: %s", test.Desc, idx-1, err)
+				continue
+			}
+			// Decode only fills in the data, not the form of the line
+			got := Event{Time: r.Time(), Name: r.Name(), Data: dst.Elem().Interface(), Form: want.Form}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: event %d:\n got: %#v\nwant: %#v", test.Desc, idx-1, got, want)
+			}
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: error: %s", test.Desc, err)
+		}
+		if idx != len(test.Events) {
+			t.Errorf("%s: got %d events, want %d", test.Desc, idx, len(test.Events))
+		}
+	}
+}
+
+func TestScanShared(t *testing.T) {
+	// Enough lines to refill the read buffer, so that anything which still
+	// refers to the first lines would see them overwritten.
+	const header = "10/18 20:30:00.123  COMBAT_LOG_VERSION,20,ADVANCED_LOG_ENABLED,0,BUILD_VERSION,10.1.7,PROJECT_ID,1\n"
+	lines := bytes.NewBufferString(header)
+	for lines.Len() < 2*ReadBufferSize {
+		lines.WriteString(benchDecodeLine + "\n")
+	}
+
+	var first GUID
+	r := NewReader(lines)
+	r.Filter = &Filter{
+		Units: func(source, dest GUID) bool {
+			if len(first) == 0 {
+				first = source
+			}
+			return true
+		},
+	}
+	var v LogVersion
+	for r.Scan() {
+		if r.Name() == LogVersionEvent {
+			if err := r.Decode(&v); err != nil {
+				t.Fatalf("decode header: %s", err)
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+
+	if got, want := v.Build, "10.1.7"; got != want {
+		t.Errorf("decoded build = %q, want %q", got, want)
+	}
+	if got, want := r.Version().Build, "10.1.7"; got != want {
+		t.Errorf("reader build = %q, want %q", got, want)
+	}
+	if got, want := first, GUID("0xF15079A30069A7D9"); got != want {
+		t.Errorf("first source = %q, want %q", got, want)
+	}
+}
+
+func TestIntern(t *testing.T) {
+	r := NewReader(bytes.NewBufferString(decodeTests[2].Lines))
+	for r.Next() {
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+
+	// Names and GUIDs are interned, but power changes on every line
+	for _, s := range []string{`"Kyle-Realm"`, "Player-1084-0A1B2C3D", `"Fireball"`} {
+		if _, ok := r.strings.strings[s]; !ok {
+			t.Errorf("%s was not interned", s)
+		}
+	}
+	for _, s := range []string{"0", "100"} {
+		if _, ok := r.strings.strings[s]; ok {
+			t.Errorf("%s was interned", s)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, test := range decodeTests {
+		buf := new(bytes.Buffer)
+		if err := Write(buf, test.Events); err != nil {
+			t.Errorf("%s: write: %s", test.Desc, err)
+			continue
+		}
+		if got, want := buf.String(), test.Lines[1:]; got != want {
+			t.Errorf("%s: wrote:\n%s\nwant:\n%s", test.Desc, got, want)
+		}
+
+		cl, err := Read(buf)
+		if err != nil {
+			t.Errorf("%s: read: %s", test.Desc, err)
+		}
+		if !reflect.DeepEqual(cl, test.Events) {
+			t.Errorf("%s: events did not round-trip", test.Desc)
+		}
+	}
+}
+
+// roundTripLog is in the format written by a recent client, with optional
+// fields which are present but zero, bools written as 0 and names which are
+// not ASCII.
+var roundTripLog = `10/18 20:30:00.123  COMBAT_LOG_VERSION,20,ADVANCED_LOG_ENABLED,1,BUILD_VERSION,10.1.7,PROJECT_ID,1
+10/18 20:30:00.500  ENCOUNTER_START,2680,"Rashok, the Elder",16,20,2569
+10/18 20:30:01.000  SPELL_DAMAGE,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,133,"Fireball",0x4,Creature-0-3137-1530-1234-103685-00004F2B6A,0000000000000000,950000,1000000,0,0,1200,0,0,100,100,0,-3000.5,500.25,1530,1.5,63,12000,12500,-1,4,0,0,0,1,nil,nil,nil
+10/18 20:30:01.100  SWING_MISSED,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,DODGE,nil
+10/18 20:30:01.200  SPELL_MISSED,Creature-0-3137-1530-1234-103685-00004F2B6A,"Boss",0x10a48,0x0,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,374361,"Ancient Fury",0x4,ABSORB,nil,21400,21400,nil
+10/18 20:30:01.250  SPELL_AURA_APPLIED,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0,17,"Power Word: Shield",0x2,BUFF
+10/18 20:30:02.000  UNIT_DIED,0000000000000000,nil,0x80000000,0x80000000,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0
+10/18 20:30:03.000  UNIT_DIED,0000000000000000,nil,0x80000000,0x80000000,Creature-0-3137-409-1234-11502-00004F2B6C,"Ragnarös",0x10a48,0x0
+10/18 20:34:10.000  ENCOUNTER_END,2680,"Rashok, the Elder",16,20,0,250000
+`
+
+func TestWriteRoundTrip(t *testing.T) {
+	cl, err := Read(bytes.NewBufferString(roundTripLog))
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Write(buf, cl); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	got, want := strings.Split(buf.String(), "\n"), strings.Split(roundTripLog, "\n")
+	if len(got) != len(want) {
+		t.Fatalf("wrote %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\n got: %s\nwant: %s", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestWriteTimeStamps(t *testing.T) {
+	// The year and zone are only written if the client wrote them
+	const died = `  UNIT_DIED,0000000000000000,nil,0x80000000,0x80000000,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0`
+	lines := "12/31 23:59:59.500" + died + "\n" +
+		"1/1 00:00:00.250" + died + "\n" +
+		"1/1/2012 00:00:01.000-4" + died + "\n" +
+		"1/1/2012 00:00:02.000" + died + "\n"
+
+	r := NewReader(bytes.NewBufferString(lines))
+	r.Year, r.ZoneOffset = 2011, 3600
+	var cl CombatLog
+	for r.Next() {
+		cl = append(cl, r.Event())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if got, want := cl[1].Time.Year, int64(2012); got != want {
+		t.Errorf("year = %d, want %d", got, want)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Write(buf, cl); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if got := buf.String(); got != lines {
+		t.Errorf("wrote:\n%s\nwant:\n%s", got, lines)
+	}
+}
+
+var timeStampTests = []struct {
+	Year  int64
+	Lines string
+	Times []time.Time
+}{
+	{
+		Year: 2011,
+		Lines: `
+12/31 23:59:59.500  UNIT_DIED,0x0000000000000000,nil,0x80000000,0x80000000,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0
+1/1 00:00:00.25  UNIT_DIED,0x0000000000000000,nil,0x80000000,0x80000000,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0
+`,
+		Times: []time.Time{
+			{Year: 2011, Month: 12, Day: 31, Hour: 23, Minute: 59, Second: 59, Nanosecond: 500000000},
+			{Year: 2012, Month: 1, Day: 1, Nanosecond: 250000000},
+		},
+	},
+	{
+		Lines: `
+10/18/2026 20:30:00.1234-4  UNIT_DIED,0000000000000000,nil,0x80000000,0x80000000,Player-1084-0A1B2C3D,"Kyle-Realm",0x512,0x0
+`,
+		Times: []time.Time{
+			{Year: 2026, Month: 10, Day: 18, Hour: 20, Minute: 30, Nanosecond: 123400000, ZoneOffset: -4 * 3600},
+		},
+	},
+}
+
+func TestTimeStamps(t *testing.T) {
+	for i, test := range timeStampTests {
+		r := NewReader(bytes.NewBufferString(test.Lines))
+		r.Year = test.Year
+		idx := 0
+		for ; r.Next(); idx++ {
+			if idx >= len(test.Times) {
+				continue
+			}
+			if got, want := r.Event().Time, test.Times[idx]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%d. event %d: time = %#v, want %#v", i, idx, got, want)
+			}
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%d. error: %s", i, err)
+		}
+		if idx != len(test.Times) {
+			t.Errorf("%d. got %d events, want %d", i, idx, len(test.Times))
+		}
+	}
+}
+
+func TestParseLogName(t *testing.T) {
+	start, ok := ParseLogName("/logs/WoWCombatLog-101826_203000.txt")
+	if !ok {
+		t.Fatalf("ParseLogName failed")
+	}
+	if start.Year != 2026 || start.Month != 10 || start.Day != 18 || start.Hour != 20 || start.Minute != 30 {
+		t.Errorf("ParseLogName = %s, want 2026-10-18 20:30:00", start.Format("2006-01-02 15:04:05"))
+	}
+	if _, ok := ParseLogName("WoWCombatLog.txt"); ok {
+		t.Errorf("ParseLogName(WoWCombatLog.txt) succeeded")
+	}
+}
+
+var lenientLines = `garbage
+9/25 19:03:23.045  SWING_DAMAGE,0xF15096640000699C,"Argent Warhorse",0xa18,0x0,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0,155,-1,1,0,0,0,nil,nil,nil
+9/25 19:03:23.046  NOT_AN_EVENT,1,2,3
+9/25 19:03:23.047  SWING_DAMAGE,0xF15096640000699C,"Argent Warhorse",0xa18,0x0,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0,lots,-1,1,0,0,0,nil,nil,nil
+9/25 19:03:23.048  SWING_DAMAGE,0xF15096640000699C,"Argent Warhorse",0xa18,0x0,0xF15079A30069A7D9,"Pustulent Horror",0xa48,0x0,155,-1,1,0,0,0,nil,nil,nil
+`
+
+func TestReaderLenient(t *testing.T) {
+	var called int
+	r := NewReader(bytes.NewBufferString(lenientLines))
+	r.Lenient = true
+	r.OnError = func(*ParseError) { called++ }
+
+	events := 0
+	for r.Next() {
+		events++
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("lenient read: %s", err)
+	}
+	if got, want := events, 3; got != want {
+		t.Errorf("got %d events, want %d", got, want)
+	}
+
+	errs := r.Errors()
+	if got, want := len(errs), 2; got != want {
+		t.Fatalf("got %d errors, want %d", got, want)
+	}
+	if called != len(errs) {
+		t.Errorf("OnError called %d times, want %d", called, len(errs))
+	}
+	for i, want := range []struct {
+		Line      int
+		Offset    int64
+		Field     int
+		FieldName string
+	}{
+		{1, 0, -1, ""},
+		{4, 200, 8, "SwingDamage.Damage.Amount"},
+	} {
+		got := errs[i]
+		if got.Line != want.Line || got.Offset != want.Offset || got.Field != want.Field || got.FieldName != want.FieldName {
+			t.Errorf("error %d = line %d, offset %d, field %d (%s); want line %d, offset %d, field %d (%s)",
+				i, got.Line, got.Offset, got.Field, got.FieldName, want.Line, want.Offset, want.Field, want.FieldName)
+		}
+	}
+
+	// A strict reader stops at the first error
+	r = NewReader(bytes.NewBufferString(lenientLines))
+	for r.Next() {
+		t.Errorf("strict reader returned an event")
+	}
+	if perr, ok := r.Err().(*ParseError); !ok || perr.Line != 1 {
+		t.Errorf("strict reader error = %v, want line 1 ParseError", r.Err())
+	}
+}
+
+type testCustomEvent struct {
+	Common
+	Spell
+	Charges int64
+	Note    string `combatlog:"optional"`
+}
+
+func TestRegisterEvent(t *testing.T) {
+	if err := RegisterEvent("TEST_CUSTOM_EVENT", &testCustomEvent{}); err != nil {
+		t.Fatalf("register: %s", err)
+	}
+	// Don't leave the event registered for other tests
+	defer func() {
+		eventTypes["TEST_CUSTOM_EVENT"] = eventFactory{}, false
+	}()
+	cl, err := Read(bytes.NewBufferString(`9/25 19:03:23.045  TEST_CUSTOM_EVENT,0xF15096640000699C,"Argent Warhorse",0xa18,0x0,0x0000000000000000,nil,0x80000000,0x80000000,1234,"Test",0x1,3` + "\n"))
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if len(cl) != 1 {
+		t.Fatalf("got %d events, want 1", len(cl))
+	}
+	got, ok := cl[0].Data.(testCustomEvent)
+	if !ok {
+		t.Fatalf("got %T, want testCustomEvent", cl[0].Data)
+	}
+	if got.Charges != 3 || got.Spell.Name != "Test" || got.Note != "" {
+		t.Errorf("got %#v", got)
+	}
+
+	bad := []struct {
+		Name  string
+		Proto interface{}
+	}{
+		{"TEST_NOT_POINTER", testCustomEvent{}},
+		{"TEST_BAD_TAG", &struct {
+			Amount int64 `combatlog:"sometimes"`
+		}{}},
+		{"TEST_BAD_TYPE", &struct{ Amounts []int64 }{}},
+		{LogVersionEvent, &testCustomEvent{}},
+	}
+	for _, test := range bad {
+		if err := RegisterEvent(test.Name, test.Proto); err == nil {
+			t.Errorf("register(%s) succeeded, want error", test.Name)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	lines := decodeTests[0].Lines + decodeTests[1].Lines + decodeTests[2].Lines
+	horror := GUID("0xF15079A30069A7D9")
+	after := time.Time{Month: 9, Day: 25, Hour: 19, Minute: 3, Second: 23, Nanosecond: 50000000}
+
+	tests := []struct {
+		Desc   string
+		Filter *Filter
+		Count  int
+	}{
+		{"all", &Filter{}, 6},
+		{"names", NewFilter("SWING_DAMAGE", "COMBAT_LOG_VERSION"), 4},
+		{"units", &Filter{Units: func(src, dst GUID) bool { return src == horror }}, 2},
+		{"time", &Filter{After: &after}, 3},
+	}
+	for _, test := range tests {
+		r := NewReader(bytes.NewBufferString(lines))
+		r.Filter = test.Filter
+		count := 0
+		for r.Next() {
+			count++
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: error: %s", test.Desc, err)
+		}
+		if count != test.Count {
+			t.Errorf("%s: got %d events, want %d", test.Desc, count, test.Count)
+		}
+	}
+
+	// Reading stops after Before, so the bad line at the end is never read
+	before := after
+	for _, workers := range []int{1, 2} {
+		r := NewReader(bytes.NewBufferString(lines + "garbage\n"))
+		r.Filter = &Filter{Before: &before}
+		r.Workers = workers
+		count := 0
+		for r.Next() {
+			count++
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("before, %d workers: error: %s", workers, err)
+		}
+		if got, want := count, 3; got != want {
+			t.Errorf("before, %d workers: got %d events, want %d", workers, got, want)
+		}
+	}
+}
+
 var nextFieldTests = []struct {
 	Source string
 	Comma  int
@@ -221,8 +861,64 @@ func BenchmarkDecode(b *testing.B) {
 	}
 }
 
+func BenchmarkScan(b *testing.B) {
+	r, w := io.Pipe()
+	go func() {
+		defer w.Close()
+		line := benchDecodeLine + "\n"
+		for i := 0; i < b.N; i++ {
+			io.WriteString(w, line)
+		}
+	}()
+	cr := NewReader(r)
+	var sd SpellDamage
+	for cr.Scan() {
+		if err := cr.Decode(&sd); err != nil {
+			panic(err)
+		}
+	}
+	if err := cr.Err(); err != nil {
+		panic(err)
+	}
+}
+
+// benchCSV returns the fields of benchDecodeLine and their factory.
+func benchCSV() (eventFactory, string) {
+	_, name, csv, _ := splitLine(benchDecodeLine)
+	return eventTypes[name], csv
+}
+
+func BenchmarkCreate(b *testing.B) {
+	factory, csv := benchCSV()
+	in := newInterner()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := factory.create(csv, LogVersion{}, in); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	factory, csv := benchCSV()
+	in := newInterner()
+	var sd SpellDamage
+	for i := 0; i < b.N; i++ {
+		if _, err := factory.decode(reflect.ValueOf(&sd), csv, LogVersion{}, in); err != nil {
+			panic(err)
+		}
+	}
+}
+
 var benchFile = "CombatLog.Bench.txt"
 
+// BenchmarkParseTimeStamp shows that timestamps are cheap enough to parse in
+// full on every line, without caching the date and time of the last one.
+func BenchmarkParseTimeStamp(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		parseTimeStamp("9/25 19:03:22.951")
+	}
+}
+
 func BenchmarkReadFile(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		ReadFile(benchFile)
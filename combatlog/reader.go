@@ -0,0 +1,576 @@
+package combatlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// A Reader decodes a combat log one Event at a time, so that logs which do
+// not fit in memory can still be processed.  Typical usage is:
+//
+//	r := combatlog.NewReader(file)
+//	for r.Next() {
+//		e := r.Event()
+//		...
+//	}
+//	if err := r.Err(); err != nil {
+//		...
+//	}
+type Reader struct {
+	// Lenient causes lines which cannot be parsed to be skipped instead of
+	// stopping the Reader.  The errors can be retrieved with Errors.
+	Lenient bool
+
+	// OnError, if set, is called for each line which cannot be parsed.
+	OnError func(*ParseError)
+
+	// Filter, if set, selects which lines are decoded.  Lines which do not
+	// match are skipped without decoding their fields.
+	Filter *Filter
+
+	// Year is the year in which the log starts.  Older clients do not
+	// write the year in each timestamp, so unless it is set events have
+	// year 0 (or 1, etc, if the log crosses the new year).  Open sets it
+	// from the file name or modification time.
+	Year int64
+
+	// ZoneOffset (in seconds east of UTC) and Zone are used as the zone of
+	// each event when the client does not write one.  The client writes
+	// timestamps in its own local time.  Open sets them to the local zone.
+	ZoneOffset int
+	Zone       string
+
+	// Workers, if greater than one, is the number of goroutines used to
+	// decode lines.  Events are still returned in the order of the log.
+	// The options above must not be changed once Next has been called.
+	Workers int
+
+	lines   *bufio.Reader
+	closer  io.Closer
+	seeker  io.ReadSeeker // the log, if it can be seeked
+	event   Event
+	err     os.Error
+	version LogVersion
+	errors  []*ParseError
+	pipe    *pipeline // used when Workers > 1
+	strings *interner
+
+	// The line found by Scan
+	scanned rawLine
+	scanCSV string
+
+	// Events before this time (in nanoseconds) are skipped after a seek
+	seekTime int64
+
+	// Set once an event is after Filter.Before, if the log is in time order
+	past      bool
+	unordered bool // the log is several logs which may overlap
+
+	// Position of the next line
+	line   int
+	offset int64
+
+	// Year tracking
+	endMonth  int   // month in which the log was last modified, if known
+	lastMonth int   // month of the previous event
+	years     int64 // number of times the year has rolled over
+}
+
+// NewReader returns a Reader which decodes events from r.
+func NewReader(r io.Reader) *Reader {
+	lines, err := bufio.NewReaderSize(r, ReadBufferSize)
+	return &Reader{
+		lines:   lines,
+		err:     err,
+		strings: newInterner(),
+	}
+}
+
+// Open opens the named log and returns a Reader for it.  Logs compressed with
+// gzip, bzip2 or zstd are decompressed, and the logs in a zip archive are read
+// one after another in the order they were started.  The year in which the log
+// starts is taken from the (uncompressed) file name if it was written by the
+// client, and otherwise is guessed from the modification time of the file.
+// The caller must call Close when done.
+func Open(filename string) (*Reader, os.Error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	log, closer, name, err := openLog(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewReader(log)
+	r.closer = closer
+	if file, ok := log.(*os.File); ok {
+		r.seeker = file
+	}
+	if a, ok := log.(*archiveReader); ok {
+		r.unordered = len(a.files) > 1
+	}
+	r.setStart(name, fi)
+	return r, nil
+}
+
+// setStart sets the year and zone of the log called name, which was last
+// modified according to fi.
+func (r *Reader) setStart(name string, fi *os.FileInfo) {
+	mtime := time.SecondsToLocalTime(fi.Mtime_ns / 1e9)
+	if start, ok := ParseLogName(name); ok {
+		r.Year = start.Year
+	} else {
+		r.Year, r.endMonth = mtime.Year, mtime.Month
+	}
+	r.ZoneOffset, r.Zone = mtime.ZoneOffset, mtime.Zone
+}
+
+// Close closes the file opened by Open and stops any goroutines decoding
+// lines.  It does nothing else for a Reader returned by NewReader.
+func (r *Reader) Close() os.Error {
+	r.stopPipeline()
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Next advances the Reader to the next event in the log.  It returns false
+// when the end of the log is reached or an error occurs; Err distinguishes
+// between the two.
+func (r *Reader) Next() bool {
+	if r.err != nil || r.past {
+		return false
+	}
+	if r.Workers > 1 {
+		return r.nextParallel()
+	}
+
+	for {
+		l, err := r.readLine(false)
+		if err != nil {
+			if err != os.EOF {
+				r.err = err
+			}
+			return false
+		}
+		d := decodeLine(l, r.version, r.Filter, r.strings)
+		if r.accept(&d) {
+			return true
+		}
+		if r.err != nil || r.past {
+			return false
+		}
+	}
+	panic("unreachable")
+}
+
+// Scan advances the Reader to the next line of the log like Next, but does
+// not decode the fields of the event.  Name and Time describe the line, and
+// Decode decodes its fields into a value supplied by the caller.  Together
+// they read a log without allocating for each event.  Scan ignores Workers,
+// and Event is not valid after it.
+func (r *Reader) Scan() bool {
+	if r.err != nil || r.past {
+		return false
+	}
+
+	for {
+		l, err := r.readLine(true)
+		if err != nil {
+			if err != os.EOF {
+				r.err = err
+			}
+			return false
+		}
+		d, csv := scanLine(l, r.Filter)
+		if d.perr != nil {
+			// The line will be overwritten by the next read
+			d.perr.Text = copyString(d.perr.Text)
+		} else if !d.skip {
+			d.event.Name, _ = r.strings.intern(d.event.Name)
+		}
+		if r.accept(&d) {
+			r.scanned, r.scanCSV = l, csv
+			return true
+		}
+		if r.err != nil || r.past {
+			return false
+		}
+	}
+	panic("unreachable")
+}
+
+// Name returns the name of the event found by Scan.
+func (r *Reader) Name() string {
+	return r.event.Name
+}
+
+// Time returns the time of the event found by Scan.
+func (r *Reader) Time() time.Time {
+	return r.event.Time
+}
+
+// Decode decodes the fields of the event found by Scan into dst, which must
+// be a pointer to the type registered for the event (or a *LogVersion for
+// the header).  Every field of *dst is overwritten, so the same value can be
+// reused for each event.  Names and GUIDs are shared between events rather
+// than copied.
+func (r *Reader) Decode(dst interface{}) os.Error {
+	name := r.event.Name
+	if v, ok := dst.(*LogVersion); ok && name == LogVersionEvent {
+		*v = r.version
+		return nil
+	}
+
+	factory, ok := eventTypes[name]
+	if !ok {
+		return fmt.Errorf("combatlog: no type registered for %s", name)
+	}
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Ptr || val.Type().Elem() != factory.emptyTyp {
+		return fmt.Errorf("combatlog: cannot decode %s into %T", name, dst)
+	}
+
+	_, err := factory.decode(val, r.scanCSV, r.version, r.strings)
+	if err != nil {
+		l := r.scanned
+		l.text = copyString(l.text)
+		return lineError(l, err)
+	}
+	return nil
+}
+
+// A rawLine is one line of the log before it is decoded.
+type rawLine struct {
+	text   string // the line without its line ending
+	line   int
+	offset int64
+	perr   *ParseError // set if the line could not be read
+}
+
+// readLine reads the next line of the log.  It returns os.EOF after the last
+// line.  Lines which are too long are returned with perr set.  If shared is
+// true, the text of the line is not copied out of the read buffer, so it is
+// only valid until the next read.
+func (r *Reader) readLine(shared bool) (l rawLine, err os.Error) {
+	l.offset = r.offset
+	raw, err := r.lines.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// Skip the rest of the line
+		l.perr = &ParseError{
+			Offset: r.offset,
+			Text:   string(raw),
+			Field:  -1,
+			Err:    os.NewError("line too long"),
+		}
+		for err == bufio.ErrBufferFull {
+			r.offset += int64(len(raw))
+			raw, err = r.lines.ReadSlice('\n')
+		}
+	}
+	if err != nil && err != os.EOF {
+		return l, err
+	}
+	if len(raw) == 0 && l.perr == nil {
+		return l, os.EOF
+	}
+
+	r.line++
+	r.offset += int64(len(raw))
+	l.line = r.line
+	if l.perr != nil {
+		l.perr.Line = r.line
+		return l, nil
+	}
+	if shared {
+		// The slice and string headers start with the same fields
+		l.text = *(*string)(unsafe.Pointer(&raw))
+	} else {
+		l.text = string(raw)
+	}
+	l.text = strings.TrimRight(l.text, "\r\n")
+	return l, nil
+}
+
+// fail records a ParseError.  It returns true if the Reader should continue.
+func (r *Reader) fail(err *ParseError) bool {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+	if r.Lenient {
+		r.errors = append(r.errors, err)
+		return true
+	}
+	r.err = err
+	return false
+}
+
+// Event returns the most recent event decoded by Next.
+func (r *Reader) Event() Event {
+	return r.event
+}
+
+// Err returns the first error encountered by the Reader, or nil if the
+// Reader stopped because it reached the end of the log.
+func (r *Reader) Err() os.Error {
+	return r.err
+}
+
+// Errors returns the errors for the lines which have been skipped by a
+// lenient Reader.
+func (r *Reader) Errors() []*ParseError {
+	return r.errors
+}
+
+// Version returns the most recent COMBAT_LOG_VERSION header seen by the
+// Reader.  Logs written by older clients have no header, in which case the
+// zero LogVersion is returned.
+func (r *Reader) Version() LogVersion {
+	return r.version
+}
+
+// A decodedLine is a line decoded without reference to the lines before it.
+// The year and zone of its time, which may depend on earlier lines, are
+// filled in by accept.
+type decodedLine struct {
+	event   Event
+	stamped bool // whether event.Time was parsed
+	hasYear bool
+	hasZone bool
+	skip    bool // whether the line is blank or did not match the filter
+	perr    *ParseError
+}
+
+// splitLine splits a line into its timestamp, event name and fields.
+func splitLine(lstr string) (stamp, name, csv string, ok bool) {
+	// Figure out where the event starts
+	if len(lstr) <= len(TimeStampFormat) {
+		return
+	}
+	start := strings.IndexFunc(lstr[len(TimeStampFormat):], start_of_event)
+	if start < 0 {
+		return
+	}
+	start += len(TimeStampFormat)
+
+	csv = lstr[start:]
+	comma := strings.IndexRune(csv, ',')
+	if comma < 0 {
+		return
+	}
+	return strings.TrimSpace(lstr[:start]), csv[:comma], csv[comma+1:], true
+}
+
+// scanLine decodes everything about l except the fields of its event, which
+// are returned in csv.  Only COMBAT_LOG_VERSION headers are fully decoded.
+// It only reads its arguments, so lines may be scanned on several goroutines.
+func scanLine(l rawLine, f *Filter) (d decodedLine, csv string) {
+	fail := func(err os.Error) (decodedLine, string) {
+		d.perr = lineError(l, err)
+		return d, ""
+	}
+
+	if l.perr != nil {
+		d.perr = l.perr
+		return d, ""
+	}
+	// Skip the line if it's blank
+	if len(l.text) == 0 {
+		d.skip = true
+		return d, ""
+	}
+
+	stamp, name, csv, ok := splitLine(l.text)
+	if !ok {
+		return fail(os.NewError("malformatted line"))
+	}
+
+	var err os.Error
+	d.event.Name = name
+	d.event.Time, d.hasYear, d.hasZone, err = parseTimeStamp(stamp)
+	if err != nil {
+		return fail(err)
+	}
+	d.stamped = true
+
+	if name == LogVersionEvent {
+		// This is decoded even if it is skipped, because it changes the
+		// layout of the events after it.
+		if d.event.Data, err = parseLogVersion(csv); err != nil {
+			return fail(err)
+		}
+		return d, ""
+	}
+
+	// The time can only be checked here if it is complete; otherwise accept
+	// checks it once the year and zone are known.
+	if f != nil {
+		if !f.matchName(name) || (d.hasYear && d.hasZone && !f.matchTime(d.event.Time)) {
+			d.skip = true
+			return d, ""
+		}
+		if factory, ok := eventTypes[name]; ok && factory.units && !f.matchUnits(csv) {
+			d.skip = true
+			return d, ""
+		}
+	}
+	return d, csv
+}
+
+// decodeLine scans l and decodes its fields using the layout for the log
+// header v.  Each goroutine decoding lines must use its own interner.
+func decodeLine(l rawLine, v LogVersion, f *Filter, in *interner) decodedLine {
+	d, csv := scanLine(l, f)
+	if d.perr != nil || d.skip {
+		return d
+	}
+	// Don't keep the whole line alive for the sake of its name
+	d.event.Name, _ = in.intern(d.event.Name)
+	if d.event.Data != nil {
+		return d
+	}
+
+	factory, ok := eventTypes[d.event.Name]
+	if !ok {
+		d.event.Data = RawEvent{
+			Name:   d.event.Name,
+			Fields: splitFields(csv),
+		}
+	} else if data, form, err := factory.create(csv, v, in); err != nil {
+		d.perr = lineError(l, err)
+	} else {
+		d.event.Data, d.event.Form = data, form
+	}
+	return d
+}
+
+// lineError returns err, which may be a *ParseError, as a ParseError for l.
+func lineError(l rawLine, err os.Error) *ParseError {
+	perr, ok := err.(*ParseError)
+	if !ok {
+		perr = &ParseError{Field: -1, Err: err}
+	}
+	perr.Line, perr.Offset, perr.Text = l.line, l.offset, l.text
+	return perr
+}
+
+// accept finishes decoding d, which must be the line after the last one
+// accepted.  It returns true if d is the next event; otherwise r.err is set
+// if the Reader should stop.
+func (r *Reader) accept(d *decodedLine) bool {
+	if d.perr != nil {
+		r.fail(d.perr)
+		return false
+	}
+	if d.stamped {
+		r.fixStamp(&d.event, d.hasYear, d.hasZone)
+
+		// Nothing after Before will match, so stop reading
+		if f := r.Filter; f != nil && f.Before != nil && !r.unordered && d.event.Time.Nanoseconds() > f.Before.Nanoseconds() {
+			r.past = true
+			return false
+		}
+	}
+	if v, ok := d.event.Data.(LogVersion); ok {
+		r.version = v
+	}
+	if d.skip {
+		return false
+	}
+	if r.seekTime != 0 {
+		if d.event.Time.Nanoseconds() < r.seekTime {
+			return false
+		}
+		r.seekTime = 0
+	}
+	if f := r.Filter; f != nil && (!f.matchTime(d.event.Time) || !f.matchName(d.event.Name)) {
+		return false
+	}
+	r.event = d.event
+	return true
+}
+
+// fixStamp fills in the year and zone of an event's time if the client did
+// not write them, and records that it did so in the event's form.
+func (r *Reader) fixStamp(e *Event, hasYear, hasZone bool) {
+	etime := &e.Time
+	if !hasYear {
+		switch {
+		case r.lastMonth == 0 && r.endMonth > 0 && etime.Month > r.endMonth:
+			// The log started in the year before it was last modified
+			r.years--
+		case r.lastMonth > 0 && etime.Month < r.lastMonth:
+			// Happy new year!
+			r.years++
+		}
+		etime.Year = r.Year + r.years
+		e.Form.NoYear = etime.Year != 0
+	}
+	r.lastMonth = etime.Month
+
+	if !hasZone {
+		etime.ZoneOffset, etime.Zone = r.ZoneOffset, r.Zone
+		e.Form.NoZone = etime.ZoneOffset != 0
+	}
+}
+
+// LogVersionEvent is the name of the header event written by newer clients.
+const LogVersionEvent = "COMBAT_LOG_VERSION"
+
+// parseLogVersion decodes the fields of a COMBAT_LOG_VERSION line, which look
+// like:
+//
+//	20,ADVANCED_LOG_ENABLED,1,BUILD_VERSION,10.1.7,PROJECT_ID,1
+func parseLogVersion(csv string) (v LogVersion, err os.Error) {
+	fields := splitFields(csv)
+	if len(fields) == 0 || len(fields)%2 != 1 {
+		return v, fmt.Errorf("malformed %s: %q", LogVersionEvent, csv)
+	}
+
+	if v.Version, err = strconv.Atoi(fields[0]); err != nil {
+		return v, fmt.Errorf("bad log version %q: %s", fields[0], err)
+	}
+	for i := 1; i < len(fields); i += 2 {
+		key, val := fields[i], fields[i+1]
+		switch key {
+		case "ADVANCED_LOG_ENABLED":
+			v.Advanced = val == "1"
+		case "BUILD_VERSION":
+			// The line may be in a shared buffer (see Scan)
+			v.Build = copyString(val)
+		case "PROJECT_ID":
+			if v.ProjectID, err = strconv.Atoi(val); err != nil {
+				return v, fmt.Errorf("bad project ID %q: %s", val, err)
+			}
+		}
+	}
+	return v, nil
+}
+
+// A ParseError describes a line of the log which could not be decoded.
+type ParseError struct {
+	Line   int    // line number, starting at 1
+	Offset int64  // byte offset of the start of the line
+	Text   string // the line itself
+
+	Field     int    // index of the field which failed, or -1
+	FieldName string // name of the field which failed, e.g. "SpellDamage.Damage.Amount"
+
+	Err os.Error
+}
+
+func (e *ParseError) String() string {
+	if e.Field >= 0 {
+		return fmt.Sprintf("combatlog: line %d: field %d (%s): %s", e.Line, e.Field, e.FieldName, e.Err)
+	}
+	return fmt.Sprintf("combatlog: line %d: %s", e.Line, e.Err)
+}
@@ -0,0 +1,131 @@
+package combatlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimeStamp parses a timestamp written by the client, which looks like
+// one of:
+//
+//	9/25 19:03:22.951
+//	9/25/2011 19:03:22.9510-4
+//
+// The second form, written by newer clients, includes the year and may
+// include the offset of the client's time zone from UTC in hours.
+func parseTimeStamp(stamp string) (t time.Time, hasYear, hasZone bool, err os.Error) {
+	bad := func(why string) os.Error {
+		return fmt.Errorf("bad timestamp %q: %s", stamp, why)
+	}
+
+	sp := strings.IndexRune(stamp, ' ')
+	if sp < 0 {
+		return t, false, false, bad("no time")
+	}
+	date, clock := stamp[:sp], strings.TrimSpace(stamp[sp+1:])
+
+	mdy := strings.Split(date, "/")
+	if len(mdy) != 2 && len(mdy) != 3 {
+		return t, false, false, bad("invalid date")
+	}
+	if t.Month, err = strconv.Atoi(mdy[0]); err != nil || t.Month < 1 || t.Month > 12 {
+		return t, false, false, bad("invalid month")
+	}
+	if t.Day, err = strconv.Atoi(mdy[1]); err != nil || t.Day < 1 || t.Day > 31 {
+		return t, false, false, bad("invalid day")
+	}
+	if len(mdy) == 3 {
+		if t.Year, err = strconv.Atoi64(mdy[2]); err != nil {
+			return t, false, false, bad("invalid year")
+		}
+		hasYear = true
+	}
+
+	if z := strings.IndexAny(clock, "+-"); z >= 0 {
+		hours, err := strconv.Atoi(clock[z:])
+		if err != nil {
+			return t, false, false, bad("invalid zone")
+		}
+		t.ZoneOffset = hours * 3600
+		clock, hasZone = clock[:z], true
+	}
+
+	hms := strings.Split(clock, ":")
+	if len(hms) != 3 {
+		return t, false, false, bad("invalid time")
+	}
+	if t.Hour, err = strconv.Atoi(hms[0]); err != nil {
+		return t, false, false, bad("invalid hour")
+	}
+	if t.Minute, err = strconv.Atoi(hms[1]); err != nil {
+		return t, false, false, bad("invalid minute")
+	}
+	sec, frac := hms[2], ""
+	if dot := strings.IndexRune(sec, '.'); dot >= 0 {
+		sec, frac = sec[:dot], sec[dot+1:]
+	}
+	if t.Second, err = strconv.Atoi(sec); err != nil {
+		return t, false, false, bad("invalid second")
+	}
+	if len(frac) > 9 {
+		frac = frac[:9]
+	}
+	if len(frac) > 0 {
+		if t.Nanosecond, err = strconv.Atoi(frac); err != nil {
+			return t, false, false, bad("invalid fraction")
+		}
+		for i := len(frac); i < 9; i++ {
+			t.Nanosecond *= 10
+		}
+	}
+	return t, hasYear, hasZone, nil
+}
+
+// formatTimeStamp is the inverse of parseTimeStamp.  Times with a year are
+// written in the newer format, along with their zone offset if it is not 0,
+// unless form says that the timestamp they were read from did not have them.
+func formatTimeStamp(t time.Time, form LineForm) string {
+	if t.Year == 0 || form.NoYear {
+		return t.Format(TimeStampFormat)
+	}
+	stamp := t.Format(TimeStampYearFormat)
+	if t.ZoneOffset != 0 && !form.NoZone {
+		stamp += fmt.Sprintf("%+d", t.ZoneOffset/3600)
+	}
+	return stamp
+}
+
+// ParseLogName parses the time at which a log started from its file name,
+// which the client writes as WoWCombatLog-MMDDYY_HHMMSS.txt.  The time is in
+// the client's local time, but the returned Time has no zone.
+func ParseLogName(filename string) (start time.Time, ok bool) {
+	base := filepath.Base(filename)
+	const prefix, suffix = "WoWCombatLog-", ".txt"
+	if !strings.HasPrefix(base, prefix) || !strings.HasSuffix(base, suffix) {
+		return start, false
+	}
+	stamp := base[len(prefix) : len(base)-len(suffix)]
+	if len(stamp) != len("MMDDYY_HHMMSS") || stamp[6] != '_' {
+		return start, false
+	}
+
+	var nums [6]int
+	for i := range nums {
+		off := 2 * i
+		if i >= 3 {
+			off++
+		}
+		n, err := strconv.Atoi(stamp[off : off+2])
+		if err != nil {
+			return start, false
+		}
+		nums[i] = n
+	}
+	start.Month, start.Day, start.Year = nums[0], nums[1], 2000+int64(nums[2])
+	start.Hour, start.Minute, start.Second = nums[3], nums[4], nums[5]
+	return start, true
+}
@@ -0,0 +1,120 @@
+package combatlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"unsafe"
+)
+
+// A Writer writes events in the same text format in which they are read, so
+// that logs can be filtered or modified and then read again.
+type Writer struct {
+	w       *bufio.Writer
+	version LogVersion
+}
+
+// NewWriter returns a Writer which writes events to w.  Flush must be called
+// when writing is complete.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Write writes e as a single line of the log.  As with reading, a
+// COMBAT_LOG_VERSION event determines the layout of the events after it.
+func (w *Writer) Write(e Event) os.Error {
+	var line string
+	switch data := e.Data.(type) {
+	case LogVersion:
+		line = formatLogVersion(data)
+		w.version = data
+	case RawEvent:
+		line = data.Name
+		for _, f := range data.Fields {
+			line += "," + f
+		}
+	default:
+		factory, ok := eventTypes[e.Name]
+		if !ok {
+			return fmt.Errorf("combatlog: cannot write unknown event type %q", e.Name)
+		}
+		if typ := reflect.TypeOf(e.Data); typ != factory.emptyTyp {
+			return fmt.Errorf("combatlog: cannot write %s as %s", typ, e.Name)
+		}
+		line = e.Name + "," + factory.format(e.Data, w.version, e.Form.Fields)
+	}
+
+	stamp := formatTimeStamp(e.Time, e.Form)
+	if _, err := io.WriteString(w.w, stamp+"  "+line+"\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() os.Error {
+	return w.w.Flush()
+}
+
+// Write writes every event in cl to w.
+func Write(w io.Writer, cl CombatLog) os.Error {
+	lw := NewWriter(w)
+	for _, e := range cl {
+		if err := lw.Write(e); err != nil {
+			return err
+		}
+	}
+	return lw.Flush()
+}
+
+// format returns the CSV fields of data, which must be of the factory's
+// type.  Trailing optional fields are omitted if they are zero, unless they
+// are among the first fields fields.
+func (e eventFactory) format(data interface{}, v LogVersion, fields int) string {
+	layout := e.layout(v)
+
+	val := reflect.New(e.emptyTyp)
+	val.Elem().Set(reflect.ValueOf(data))
+	base := unsafe.Pointer(val.Pointer())
+
+	n := layout.length(base)
+	if fields > n && fields <= layout.max {
+		n = fields
+	}
+
+	csv := ""
+	for i, field := range layout.fields[:n] {
+		if i > 0 {
+			csv += ","
+		}
+		csv += field.format(base)
+	}
+	return csv
+}
+
+// length returns the number of fields written for the event at base: every
+// field up to the last one which is either required or not zero.
+func (l fieldLayout) length(base unsafe.Pointer) int {
+	for i := l.max - 1; i >= l.min; i-- {
+		if !l.fields[i].isZero(base) {
+			return i + 1
+		}
+	}
+	return l.min
+}
+
+func formatLogVersion(v LogVersion) string {
+	adv := "0"
+	if v.Advanced {
+		adv = "1"
+	}
+	return LogVersionEvent + "," + strconv.Itoa(v.Version) +
+		",ADVANCED_LOG_ENABLED," + adv +
+		",BUILD_VERSION," + v.Build +
+		",PROJECT_ID," + strconv.Itoa(v.ProjectID)
+}
@@ -0,0 +1,1026 @@
+package combatlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// This file implements a decoder for the zstd format (RFC 8878), which is
+// not in the standard library.  Dictionaries are not supported, since logs
+// are never compressed with one.
+
+const (
+	zstdMaxWindow    = 1 << 27 // the largest window written by zstd --long
+	zstdMaxBlock     = 128 << 10
+	zstdSkippableMin = 0x184D2A50
+	zstdSkippableMax = 0x184D2A5F
+)
+
+// zstdError returns a corruption error.
+func zstdError(format string, args ...interface{}) os.Error {
+	return fmt.Errorf("combatlog: zstd: "+format, args...)
+}
+
+// A zstdReader decompresses the zstd frames read from in.
+type zstdReader struct {
+	in  *bufio.Reader
+	err os.Error
+
+	// The frame being decoded
+	inFrame  bool
+	last     bool // the last block of the frame has been decoded
+	window   int
+	checksum bool
+	hash     xxhash64
+
+	// Decoded data.  The last window bytes are kept for matches to refer to;
+	// out[pos:] has not been read yet.
+	out []byte
+	pos int
+
+	block   []byte // compressed block being decoded
+	lits    []byte // literals of the block
+	litsBuf []byte // decoded literals, if they are not raw
+
+	// Entropy tables which may be repeated by later blocks in the frame
+	huf                 *huffmanTable
+	llTab, ofTab, mlTab *fseTable
+	rep                 [3]int
+}
+
+func newZstdReader(r io.Reader) *zstdReader {
+	return &zstdReader{in: bufio.NewReader(r)}
+}
+
+func (z *zstdReader) Read(p []byte) (n int, err os.Error) {
+	for z.pos == len(z.out) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n = copy(p, z.out[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+// next decodes the next block, starting a new frame if necessary.  It
+// returns os.EOF at the end of the input if it is between frames.
+func (z *zstdReader) next() os.Error {
+	if !z.inFrame {
+		return z.readFrameHeader()
+	}
+	if z.last {
+		z.inFrame = false
+		if !z.checksum {
+			return nil
+		}
+		var sum [4]byte
+		if _, err := io.ReadFull(z.in, sum[:]); err != nil {
+			return unexpected(err)
+		}
+		if uint32(z.hash.sum64()) != le32(sum[:]) {
+			return zstdError("checksum mismatch")
+		}
+		return nil
+	}
+
+	// Keep only the window, and only once it has been read
+	if len(z.out) > 2*z.window {
+		keep := z.out[len(z.out)-z.window:]
+		copy(z.out, keep)
+		z.out = z.out[:len(keep)]
+		z.pos = len(z.out)
+	}
+	start := len(z.out)
+	if err := z.readBlock(); err != nil {
+		return err
+	}
+	if z.checksum {
+		z.hash.write(z.out[start:])
+	}
+	return nil
+}
+
+// unexpected converts the end of the input in the middle of a frame into an
+// error.
+func unexpected(err os.Error) os.Error {
+	if err == os.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (z *zstdReader) readFrameHeader() os.Error {
+	var magic [4]byte
+	if n, err := io.ReadFull(z.in, magic[:]); err != nil {
+		if n == 0 && err == os.EOF {
+			return os.EOF
+		}
+		return unexpected(err)
+	}
+	switch m := le32(magic[:]); {
+	case m >= zstdSkippableMin && m <= zstdSkippableMax:
+		var size [4]byte
+		if _, err := io.ReadFull(z.in, size[:]); err != nil {
+			return unexpected(err)
+		}
+		for skip := int64(le32(size[:])); skip > 0; skip-- {
+			if _, err := z.in.ReadByte(); err != nil {
+				return unexpected(err)
+			}
+		}
+		return nil
+	case m != le32(zstdMagic):
+		return zstdError("bad magic number %#x", m)
+	}
+
+	desc, err := z.in.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	single := desc&0x20 != 0
+	if desc&0x08 != 0 {
+		return zstdError("reserved bit set in frame header")
+	}
+
+	window := 0
+	if !single {
+		b, err := z.in.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		log := 10 + uint(b>>3)
+		if log > 30 {
+			return zstdError("window too large")
+		}
+		base := 1 << log
+		window = base + base/8*int(b&7)
+	}
+
+	dictSize := []int{0, 1, 2, 4}[desc&3]
+	sizeSize := []int{0, 2, 4, 8}[desc>>6]
+	if single && sizeSize == 0 {
+		sizeSize = 1
+	}
+	var buf [12]byte
+	field := buf[:dictSize+sizeSize]
+	if _, err := io.ReadFull(z.in, field); err != nil {
+		return unexpected(err)
+	}
+	for _, b := range field[:dictSize] {
+		if b != 0 {
+			return zstdError("dictionaries are not supported")
+		}
+	}
+	if single {
+		size := uint64(0)
+		for i, b := range field[dictSize:] {
+			size |= uint64(b) << (8 * uint(i))
+		}
+		if sizeSize == 2 {
+			size += 256
+		}
+		if size > zstdMaxWindow {
+			return zstdError("window too large")
+		}
+		window = int(size)
+	}
+	if window > zstdMaxWindow {
+		return zstdError("window too large")
+	}
+
+	z.inFrame, z.last = true, false
+	z.window = window
+	z.checksum = desc&0x04 != 0
+	z.hash.reset()
+	z.out, z.pos = z.out[:0], 0
+	z.huf, z.llTab, z.ofTab, z.mlTab = nil, nil, nil, nil
+	z.rep = [3]int{1, 4, 8}
+	return nil
+}
+
+func (z *zstdReader) readBlock() os.Error {
+	var hdr [3]byte
+	if _, err := io.ReadFull(z.in, hdr[:]); err != nil {
+		return unexpected(err)
+	}
+	h := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+	z.last = h&1 != 0
+	size := h >> 3
+
+	maxBlock := zstdMaxBlock
+	if z.window < maxBlock {
+		maxBlock = z.window
+	}
+	if size > maxBlock {
+		return zstdError("block too large")
+	}
+
+	switch (h >> 1) & 3 {
+	case 0: // raw
+		start := len(z.out)
+		z.out = grow(z.out, size)
+		if _, err := io.ReadFull(z.in, z.out[start:]); err != nil {
+			return unexpected(err)
+		}
+	case 1: // RLE
+		b, err := z.in.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		start := len(z.out)
+		z.out = grow(z.out, size)
+		for i := range z.out[start:] {
+			z.out[start+i] = b
+		}
+	case 2: // compressed
+		if cap(z.block) < size {
+			z.block = make([]byte, zstdMaxBlock)
+		}
+		z.block = z.block[:size]
+		if _, err := io.ReadFull(z.in, z.block); err != nil {
+			return unexpected(err)
+		}
+		return z.decompressBlock(z.block)
+	default:
+		return zstdError("reserved block type")
+	}
+	return nil
+}
+
+// grow extends b by n bytes.
+func grow(b []byte, n int) []byte {
+	if len(b)+n > cap(b) {
+		nb := make([]byte, len(b), 2*cap(b)+n)
+		copy(nb, b)
+		b = nb
+	}
+	return b[:len(b)+n]
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func (z *zstdReader) decompressBlock(block []byte) os.Error {
+	n, err := z.readLiterals(block)
+	if err != nil {
+		return err
+	}
+	return z.readSequences(block[n:])
+}
+
+// readLiterals decodes the literals section at the start of block into
+// z.lits and returns its length.
+func (z *zstdReader) readLiterals(block []byte) (int, os.Error) {
+	if len(block) == 0 {
+		return 0, zstdError("missing literals")
+	}
+	typ, format := block[0]&3, (block[0]>>2)&3
+
+	if typ < 2 {
+		// Raw or RLE
+		var size, n int
+		switch format {
+		case 0, 2:
+			size, n = int(block[0]>>3), 1
+		case 1:
+			if len(block) < 2 {
+				return 0, zstdError("short literals header")
+			}
+			size, n = int(block[0]>>4)|int(block[1])<<4, 2
+		case 3:
+			if len(block) < 3 {
+				return 0, zstdError("short literals header")
+			}
+			size, n = int(block[0]>>4)|int(block[1])<<4|int(block[2])<<12, 3
+		}
+		if size > zstdMaxBlock {
+			return 0, zstdError("too many literals")
+		}
+		if typ == 0 {
+			if len(block) < n+size {
+				return 0, zstdError("short raw literals")
+			}
+			z.lits = block[n : n+size]
+			return n + size, nil
+		}
+		if len(block) < n+1 {
+			return 0, zstdError("short RLE literals")
+		}
+		z.litsBuf = grow(z.litsBuf[:0], size)
+		for i := range z.litsBuf {
+			z.litsBuf[i] = block[n]
+		}
+		z.lits = z.litsBuf
+		return n + 1, nil
+	}
+
+	// Huffman coded
+	var size, compSize, n int
+	streams := 4
+	switch format {
+	case 0, 1:
+		if len(block) < 3 {
+			return 0, zstdError("short literals header")
+		}
+		v := uint32(block[0]) | uint32(block[1])<<8 | uint32(block[2])<<16
+		size, compSize, n = int(v>>4&0x3FF), int(v>>14&0x3FF), 3
+		if format == 0 {
+			streams = 1
+		}
+	case 2:
+		if len(block) < 4 {
+			return 0, zstdError("short literals header")
+		}
+		v := le32(block)
+		size, compSize, n = int(v>>4&0x3FFF), int(v>>18), 4
+	case 3:
+		if len(block) < 5 {
+			return 0, zstdError("short literals header")
+		}
+		v := le32(block)
+		size, compSize, n = int(v>>4&0x3FFFF), int(v>>22)|int(block[4])<<10, 5
+	}
+	if size > zstdMaxBlock {
+		return 0, zstdError("too many literals")
+	}
+	if len(block) < n+compSize {
+		return 0, zstdError("short compressed literals")
+	}
+	data := block[n : n+compSize]
+
+	if typ == 2 {
+		huf, used, err := readHuffmanTable(data)
+		if err != nil {
+			return 0, err
+		}
+		z.huf, data = huf, data[used:]
+	} else if z.huf == nil {
+		return 0, zstdError("repeated Huffman table without a previous one")
+	}
+
+	z.litsBuf = grow(z.litsBuf[:0], size)
+	z.lits = z.litsBuf
+	var err os.Error
+	if streams == 1 {
+		err = z.huf.decode(z.lits, data)
+	} else {
+		err = z.huf.decode4(z.lits, data)
+	}
+	return n + compSize, err
+}
+
+// readSequences decodes the sequences section in data and executes the
+// sequences, appending the decoded block to z.out.
+func (z *zstdReader) readSequences(data []byte) os.Error {
+	if len(data) == 0 {
+		return zstdError("missing sequences")
+	}
+	var nseq, n int
+	switch b := int(data[0]); {
+	case b < 128:
+		nseq, n = b, 1
+	case b < 255:
+		if len(data) < 2 {
+			return zstdError("short sequences header")
+		}
+		nseq, n = (b-128)<<8|int(data[1]), 2
+	default:
+		if len(data) < 3 {
+			return zstdError("short sequences header")
+		}
+		nseq, n = int(data[1])|int(data[2])<<8+0x7F00, 3
+	}
+	if nseq == 0 {
+		if n != len(data) {
+			return zstdError("data after empty sequences section")
+		}
+		z.out = append(z.out, z.lits...)
+		return nil
+	}
+
+	if len(data) < n+1 {
+		return zstdError("short sequences header")
+	}
+	modes := data[n]
+	if modes&3 != 0 {
+		return zstdError("reserved bits set in compression modes")
+	}
+	n++
+	var err os.Error
+	var used int
+	if z.llTab, used, err = readSequenceTable(data[n:], modes>>6, z.llTab, llDefault, 9); err != nil {
+		return err
+	}
+	n += used
+	if z.ofTab, used, err = readSequenceTable(data[n:], (modes>>4)&3, z.ofTab, ofDefault, 8); err != nil {
+		return err
+	}
+	n += used
+	if z.mlTab, used, err = readSequenceTable(data[n:], (modes>>2)&3, z.mlTab, mlDefault, 9); err != nil {
+		return err
+	}
+	n += used
+
+	br, err := newBackwardReader(data[n:])
+	if err != nil {
+		return err
+	}
+	llState := br.bits(z.llTab.log)
+	ofState := br.bits(z.ofTab.log)
+	mlState := br.bits(z.mlTab.log)
+
+	lits := z.lits
+	for i := 0; i < nseq; i++ {
+		llCode := z.llTab.symbol[llState]
+		ofCode := z.ofTab.symbol[ofState]
+		mlCode := z.mlTab.symbol[mlState]
+		if int(llCode) >= len(llBase) || int(mlCode) >= len(mlBase) || ofCode > 31 {
+			return zstdError("bad sequence code")
+		}
+
+		offset := 1<<ofCode + int(br.bits(ofCode))
+		ml := int(mlBase[mlCode]) + int(br.bits(mlBits[mlCode]))
+		ll := int(llBase[llCode]) + int(br.bits(llBits[llCode]))
+
+		if offset > 3 {
+			offset -= 3
+			z.rep[2], z.rep[1], z.rep[0] = z.rep[1], z.rep[0], offset
+		} else {
+			idx := offset - 1
+			if ll == 0 {
+				idx++
+			}
+			switch idx {
+			case 0:
+				offset = z.rep[0]
+			case 3:
+				offset = z.rep[0] - 1
+			default:
+				offset = z.rep[idx]
+			}
+			if idx > 0 {
+				if idx > 1 {
+					z.rep[2] = z.rep[1]
+				}
+				z.rep[1], z.rep[0] = z.rep[0], offset
+			}
+		}
+
+		if i < nseq-1 {
+			llState = z.llTab.next(llState, br)
+			mlState = z.mlTab.next(mlState, br)
+			ofState = z.ofTab.next(ofState, br)
+		}
+
+		// Execute the sequence
+		if ll > len(lits) {
+			return zstdError("literal length too long")
+		}
+		z.out = append(z.out, lits[:ll]...)
+		lits = lits[ll:]
+		if offset <= 0 || offset > len(z.out) || offset > z.window {
+			return zstdError("match offset out of range")
+		}
+		start := len(z.out) - offset
+		if offset >= ml {
+			z.out = append(z.out, z.out[start:start+ml]...)
+		} else {
+			for j := 0; j < ml; j++ {
+				z.out = append(z.out, z.out[start+j])
+			}
+		}
+	}
+	if !br.done() {
+		return zstdError("sequences did not use the whole bitstream")
+	}
+	z.out = append(z.out, lits...)
+	return nil
+}
+
+// Literal and match length codes are the base of the length, plus the given
+// number of extra bits.
+var (
+	llBase = []uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llBits = []uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	mlBase = []uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlBits = []uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// Predefined distributions of the sequence codes
+var (
+	llDefault = mustFSETable([]int{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}, 6)
+	ofDefault = mustFSETable([]int{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}, 5)
+	mlDefault = mustFSETable([]int{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}, 6)
+)
+
+func mustFSETable(norm []int, log uint8) *fseTable {
+	t, err := newFSETable(norm, log)
+	if err != nil {
+		panic(err.String())
+	}
+	return t
+}
+
+// readSequenceTable reads the table for one kind of sequence code with the
+// given mode from the start of data, returning it and the number of bytes
+// used.
+func readSequenceTable(data []byte, mode uint8, prev, def *fseTable, maxLog uint8) (*fseTable, int, os.Error) {
+	switch mode {
+	case 0: // predefined
+		return def, 0, nil
+	case 1: // RLE
+		if len(data) == 0 {
+			return nil, 0, zstdError("short RLE table")
+		}
+		return &fseTable{symbol: []uint8{data[0]}, bits: []uint8{0}, base: []uint16{0}}, 1, nil
+	case 2: // FSE compressed
+		return readFSETable(data, maxLog)
+	}
+	if prev == nil {
+		return nil, 0, zstdError("repeated table without a previous one")
+	}
+	return prev, 0, nil
+}
+
+// An fseTable decodes a finite state entropy coded bitstream.  Each state
+// gives a symbol and how to find the next state.
+type fseTable struct {
+	log    uint8
+	symbol []uint8
+	bits   []uint8
+	base   []uint16
+}
+
+// next returns the state after s.
+func (t *fseTable) next(s uint64, br *backwardReader) uint64 {
+	return uint64(t.base[s]) + br.bits(t.bits[s])
+}
+
+// readFSETable reads a table description from the start of data, returning
+// the table and the number of bytes used.
+func readFSETable(data []byte, maxLog uint8) (*fseTable, int, os.Error) {
+	fr := &forwardReader{data: data}
+	log := uint8(fr.bits(4)) + 5
+	if log > maxLog {
+		return nil, 0, zstdError("table accuracy too high")
+	}
+	var norm []int
+	remaining := 1 << log
+	for remaining > 0 && len(norm) < 256 {
+		nbits := uint(highBit(uint32(remaining+1)) + 1)
+		val := int(fr.bits(nbits))
+		lowMask := 1<<(nbits-1) - 1
+		threshold := 1<<nbits - 1 - (remaining + 1)
+		if val&lowMask < threshold {
+			fr.pos--
+			val &= lowMask
+		} else if val > lowMask {
+			val -= threshold
+		}
+		count := val - 1
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, count)
+		if count == 0 {
+			for {
+				repeat := int(fr.bits(2))
+				for i := 0; i < repeat && len(norm) < 256; i++ {
+					norm = append(norm, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+	}
+	used := (fr.pos + 7) / 8
+	if remaining != 0 || used > len(data) {
+		return nil, 0, zstdError("bad table description")
+	}
+	t, err := newFSETable(norm, log)
+	return t, used, err
+}
+
+// newFSETable builds the decoding table for the normalized counts norm, in
+// which -1 is a probability of less than one.
+func newFSETable(norm []int, log uint8) (*fseTable, os.Error) {
+	size := 1 << log
+	t := &fseTable{
+		log:    log,
+		symbol: make([]uint8, size),
+		bits:   make([]uint8, size),
+		base:   make([]uint16, size),
+	}
+
+	// Symbols with a probability of less than one each get one cell at the
+	// end of the table; the rest are spread over the others.
+	next := make([]int, len(norm))
+	high := size
+	for s, c := range norm {
+		if c == -1 {
+			high--
+			t.symbol[high] = uint8(s)
+			next[s] = 1
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	pos := 0
+	for s, c := range norm {
+		if c <= 0 {
+			continue
+		}
+		next[s] = c
+		for i := 0; i < c; i++ {
+			t.symbol[pos] = uint8(s)
+			for pos = (pos + step) & (size - 1); pos >= high; pos = (pos + step) & (size - 1) {
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, zstdError("bad table distribution")
+	}
+
+	for i := range t.symbol {
+		n := next[t.symbol[i]]
+		next[t.symbol[i]]++
+		t.bits[i] = log - uint8(highBit(uint32(n)))
+		t.base[i] = uint16(n<<t.bits[i] - size)
+	}
+	return t, nil
+}
+
+// A huffmanTable decodes literals.  It is indexed by the next maxBits bits
+// of the stream.
+type huffmanTable struct {
+	maxBits uint8
+	symbol  []uint8
+	bits    []uint8
+}
+
+// readHuffmanTable reads a Huffman tree description from the start of data,
+// returning the table and the number of bytes used.
+func readHuffmanTable(data []byte) (*huffmanTable, int, os.Error) {
+	if len(data) == 0 {
+		return nil, 0, zstdError("missing Huffman table")
+	}
+	var weights []uint8
+	hdr := int(data[0])
+	used := 1
+	if hdr >= 128 {
+		// Weights stored directly, 4 bits each
+		n := hdr - 127
+		used += (n + 1) / 2
+		if len(data) < used {
+			return nil, 0, zstdError("short Huffman weights")
+		}
+		weights = make([]uint8, n)
+		for i := range weights {
+			b := data[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 15
+			}
+		}
+	} else {
+		// Weights compressed with FSE, using two interleaved states
+		used += hdr
+		if len(data) < used {
+			return nil, 0, zstdError("short Huffman weights")
+		}
+		t, n, err := readFSETable(data[1:used], 6)
+		if err != nil {
+			return nil, 0, err
+		}
+		br, err := newBackwardReader(data[1+n : used])
+		if err != nil {
+			return nil, 0, err
+		}
+		s1, s2 := br.bits(t.log), br.bits(t.log)
+		for len(weights) < 255 {
+			weights = append(weights, t.symbol[s1])
+			s1 = t.next(s1, br)
+			if br.overflow() {
+				weights = append(weights, t.symbol[s2])
+				break
+			}
+			weights = append(weights, t.symbol[s2])
+			s2 = t.next(s2, br)
+			if br.overflow() {
+				weights = append(weights, t.symbol[s1])
+				break
+			}
+		}
+	}
+
+	// The weight of the last symbol is implied by the total of the others
+	total := uint32(0)
+	for _, w := range weights {
+		if w > 12 {
+			return nil, 0, zstdError("bad Huffman weight")
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, zstdError("empty Huffman table")
+	}
+	maxBits := uint8(highBit(total) + 1)
+	left := uint32(1)<<maxBits - total
+	if left&(left-1) != 0 || maxBits > 11 {
+		return nil, 0, zstdError("bad Huffman weights")
+	}
+	weights = append(weights, uint8(highBit(left)+1))
+
+	// Codes are assigned from the longest to the shortest
+	var count [13]int
+	for _, w := range weights {
+		if w > 0 {
+			count[maxBits+1-w]++
+		}
+	}
+	var start [13]int
+	for b := int(maxBits); b > 1; b-- {
+		start[b-1] = start[b] + count[b]<<(int(maxBits)-b)
+	}
+	size := 1 << maxBits
+	t := &huffmanTable{
+		maxBits: maxBits,
+		symbol:  make([]uint8, size),
+		bits:    make([]uint8, size),
+	}
+	for s, w := range weights {
+		if w == 0 {
+			continue
+		}
+		b := maxBits + 1 - w
+		n := 1 << (maxBits - b)
+		for i := start[b]; i < start[b]+n; i++ {
+			t.symbol[i], t.bits[i] = uint8(s), b
+		}
+		start[b] += n
+	}
+	return t, used, nil
+}
+
+// decode decodes the single stream data into out, which must be the number
+// of literals the stream holds.
+func (t *huffmanTable) decode(out, data []byte) os.Error {
+	br, err := newBackwardReader(data)
+	if err != nil {
+		return err
+	}
+	state := br.bits(t.maxBits)
+	mask := uint64(1)<<t.maxBits - 1
+	for i := range out {
+		out[i] = t.symbol[state]
+		n := t.bits[state]
+		state = (state<<n | br.bits(n)) & mask
+	}
+	if br.pos != -int(t.maxBits) {
+		return zstdError("bad Huffman stream length")
+	}
+	return nil
+}
+
+// decode4 decodes the four streams in data, which start with a jump table.
+func (t *huffmanTable) decode4(out, data []byte) os.Error {
+	if len(data) < 6 {
+		return zstdError("short jump table")
+	}
+	s1 := int(data[0]) | int(data[1])<<8
+	s2 := int(data[2]) | int(data[3])<<8
+	s3 := int(data[4]) | int(data[5])<<8
+	data = data[6:]
+	if s1+s2+s3 > len(data) {
+		return zstdError("bad jump table")
+	}
+	per := (len(out) + 3) / 4
+	if 3*per > len(out) {
+		return zstdError("too few literals for four streams")
+	}
+	ends := []int{s1, s1 + s2, s1 + s2 + s3, len(data)}
+	start := 0
+	for i, end := range ends {
+		o := out[i*per:]
+		if i < 3 {
+			o = o[:per]
+		}
+		if err := t.decode(o, data[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// A backwardReader reads a bitstream from its end, as zstd writes entropy
+// coded data.  Reading past the start of the stream returns zeros.
+type backwardReader struct {
+	data []byte
+	pos  int // bits before pos have not been read
+}
+
+func newBackwardReader(data []byte) (*backwardReader, os.Error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, zstdError("bad bitstream padding")
+	}
+	// The highest set bit of the last byte marks the end of the stream
+	pos := 8*len(data) - 8 + highBit(uint32(data[len(data)-1]))
+	return &backwardReader{data: data, pos: pos}, nil
+}
+
+// bits reads the next n bits.
+func (br *backwardReader) bits(n uint8) uint64 {
+	if n == 0 {
+		return 0
+	}
+	br.pos -= int(n)
+	return readBits(br.data, br.pos, uint(n))
+}
+
+// done reports whether the stream has been read exactly.
+func (br *backwardReader) done() bool {
+	return br.pos == 0
+}
+
+// overflow reports whether more bits have been read than the stream holds.
+func (br *backwardReader) overflow() bool {
+	return br.pos < 0
+}
+
+// readBits returns the n bits (at most 32) starting at bit pos of data,
+// counting from the least significant bit of the first byte.  Bits outside
+// data are zero.
+func readBits(data []byte, pos int, n uint) uint64 {
+	if pos < 0 {
+		if int(n)+pos <= 0 {
+			return 0
+		}
+		return readBits(data, 0, uint(int(n)+pos)) << uint(-pos)
+	}
+	v := uint64(0)
+	first := pos / 8
+	for i := 0; i < 5 && first+i < len(data); i++ {
+		v |= uint64(data[first+i]) << (8 * uint(i))
+	}
+	return v >> uint(pos%8) & (1<<n - 1)
+}
+
+// A forwardReader reads a bitstream from its start.
+type forwardReader struct {
+	data []byte
+	pos  int
+}
+
+func (fr *forwardReader) bits(n uint) uint64 {
+	v := readBits(fr.data, fr.pos, n)
+	fr.pos += int(n)
+	return v
+}
+
+// highBit returns the index of the highest set bit of v, which must not be
+// zero.
+func highBit(v uint32) int {
+	n := -1
+	for ; v != 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// xxhash64 computes the XXH64 hash (with a seed of zero) of the data written
+// to it, which zstd uses for content checksums.
+type xxhash64 struct {
+	v     [4]uint64
+	buf   [32]byte
+	nbuf  int
+	total uint64
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func (h *xxhash64) reset() {
+	p1 := xxPrime1
+	h.v = [4]uint64{p1 + xxPrime2, xxPrime2, 0, -p1}
+	h.nbuf, h.total = 0, 0
+}
+
+func (h *xxhash64) write(p []byte) {
+	h.total += uint64(len(p))
+	if h.nbuf > 0 {
+		n := copy(h.buf[h.nbuf:], p)
+		h.nbuf += n
+		p = p[n:]
+		if h.nbuf < 32 {
+			return
+		}
+		h.stripe(h.buf[:])
+		h.nbuf = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		h.stripe(p)
+	}
+	h.nbuf = copy(h.buf[:], p)
+}
+
+func (h *xxhash64) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxRound(h.v[i], le64(p[8*i:]))
+	}
+}
+
+func (h *xxhash64) sum64() uint64 {
+	var s uint64
+	if h.total >= 32 {
+		v := h.v
+		s = rotl64(v[0], 1) + rotl64(v[1], 7) + rotl64(v[2], 12) + rotl64(v[3], 18)
+		for _, x := range v {
+			s ^= xxRound(0, x)
+			s = s*xxPrime1 + xxPrime4
+		}
+	} else {
+		s = xxPrime5
+	}
+	s += h.total
+
+	p := h.buf[:h.nbuf]
+	for ; len(p) >= 8; p = p[8:] {
+		s ^= xxRound(0, le64(p))
+		s = rotl64(s, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		s ^= uint64(le32(p)) * xxPrime1
+		s = rotl64(s, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		s ^= uint64(b) * xxPrime5
+		s = rotl64(s, 11) * xxPrime1
+	}
+
+	s ^= s >> 33
+	s *= xxPrime2
+	s ^= s >> 29
+	s *= xxPrime3
+	s ^= s >> 32
+	return s
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return rotl64(acc, 31) * xxPrime1
+}
+
+func rotl64(x uint64, n uint) uint64 {
+	return x<<n | x>>(64-n)
+}
+
+func le64(b []byte) uint64 {
+	return uint64(le32(b)) | uint64(le32(b[4:]))<<32
+}
@@ -9,6 +9,10 @@ import (
 	"github.com/kylelemons/wowlog/combatlog"
 )
 
+var (
+	deaths = flag.Bool("deaths", false, "Print a recap of each death, by encounter")
+)
+
 func main() {
 	flag.Usage = func() {
 		fmt.Printf(""+
@@ -28,14 +32,22 @@ Options:
 
 	filename := args[0]
 
-	log.Printf("Parsing %s...", filename)
-	cl, err := combatlog.ReadFile(filename)
+	if *deaths {
+		printDeaths(filename)
+		return
+	}
+
+	r, err := combatlog.Open(filename)
 	if err != nil {
-		log.Fatal("graphlog: %s", err)
+		log.Fatalf("graphlog: %s", err)
 	}
+	defer r.Close()
 
-	log.Printf("Analyzing %d records...", len(cl))
-	for _, e := range cl {
+	log.Printf("Analyzing %s...", filename)
+	count := 0
+	for r.Next() {
+		e := r.Event()
+		count++
 		norm, ok := e.Data.(Normal)
 		if !ok {
 			log.Printf("event not normal: %#v", e)
@@ -45,12 +57,19 @@ Options:
 		categorize(src)
 		categorize(dst)
 	}
-	log.Printf("Processed %d log entries with %d units in %d groups", len(cl), len(seen), len(groups))
+	if err := r.Err(); err != nil {
+		log.Fatalf("graphlog: %s", err)
+	}
+	log.Printf("Processed %d log entries with %d units in %d groups", count, len(seen), len(groups))
 
 	for group, units := range groups {
-		fmt.Printf("Group 0x%04x: (%d/%d)\n", 1 << uint(group), len(units), len(seen))
+		if len(units) == 0 {
+			continue
+		}
+		flag := combatlog.UnitFlags(1) << uint(group)
+		fmt.Printf("%s (0x%08x): (%d/%d)\n", flag, uint64(flag), len(units), len(seen))
 		for _, unit := range units {
-			fmt.Printf(" - %15b %s\n", unit.Flags, unit.Name)
+			fmt.Printf(" - %-40s %s\n", unit.Flags, unit.Name)
 		}
 	}
 }
@@ -61,7 +80,7 @@ type Normal interface {
 }
 
 var seen = map[string]bool{}
-var groups = [31][]combatlog.Unit{}
+var groups = [32][]combatlog.Unit{}
 
 func categorize(unit combatlog.Unit) {
 	if _, ok := seen[unit.Name]; ok {
@@ -75,3 +94,35 @@ func categorize(unit combatlog.Unit) {
 		}
 	}
 }
+
+func printDeaths(filename string) {
+	log.Printf("Parsing %s...", filename)
+	cl, err := combatlog.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("graphlog: %s", err)
+	}
+
+	for _, enc := range cl.Encounters() {
+		outcome := "wipe"
+		if enc.Kill {
+			outcome = "kill"
+		}
+		fmt.Printf("%s (%s, %.1fs)\n", enc.Name, outcome, float64(enc.Duration())/1e9)
+
+		for _, d := range enc.Events.Deaths(combatlog.DeathWindow) {
+			fmt.Printf("  %s died at %s: %d damage taken, %d healing received\n",
+				d.Unit.Name, d.Time.Format(combatlog.TimeStampFormat), d.DamageTaken, d.HealingReceived)
+			died := d.Time.Nanoseconds()
+			for i := range d.Events {
+				e := &d.Events[i]
+				offset := float64(e.Time.Nanoseconds()-died) / 1e9
+				src := e.Data.(Normal).GetSource()
+				fmt.Printf("    %+6.1fs %-24s %s", offset, e.Name, src.Name)
+				if e == d.KillingBlow {
+					fmt.Printf(" (killing blow, %d overkill)", d.Overkill())
+				}
+				fmt.Println()
+			}
+		}
+	}
+}